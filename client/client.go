@@ -13,6 +13,7 @@ type JsonType struct{}
 
 type Client struct {
 	conn      net.Conn
+	reader    *bufio.Reader
 	Msgs      chan types.JsonMsgI
 	connected bool
 }
@@ -24,15 +25,19 @@ func Connect(address string, port int) (*Client, error) {
 	}
 	c := Client{
 		conn:      conn,
+		reader:    bufio.NewReader(conn),
 		Msgs:      make(chan types.JsonMsgI, 1),
 		connected: true,
 	}
 	return &c, nil
 }
 
+// Listen parses the messages of the server and puts them on Msgs. Msgs is
+// closed when the connection is lost.
 func (c *Client) Listen() {
+	defer close(c.Msgs)
 	for {
-		msg, err := bufio.NewReader(c.conn).ReadString('\n')
+		msg, err := c.reader.ReadString('\n')
 		if err != nil {
 			log.Printf("Listen: %s", err.Error())
 			break
@@ -53,6 +58,14 @@ func (c *Client) Listen() {
 				break
 			}
 			c.Msgs <- readyMsg
+		case "team":
+			teamMsg := &types.TeamMsg{}
+			err = json.Unmarshal([]byte(msg), teamMsg)
+			if err != nil {
+				log.Printf("Listen: malformed team message")
+				break
+			}
+			c.Msgs <- teamMsg
 		case "chat":
 			chatMsg := &types.ChatMsg{}
 			err = json.Unmarshal([]byte(msg), chatMsg)
@@ -70,7 +83,21 @@ func (c *Client) Listen() {
 			}
 			c.Msgs <- conAck
 		case "start_game":
-			c.Msgs <- gen
+			startMsg := &types.StartGameMsg{}
+			err = json.Unmarshal([]byte(msg), startMsg)
+			if err != nil {
+				log.Printf("Listen: malformed start game message")
+				break
+			}
+			c.Msgs <- startMsg
+		case "server_tick":
+			tickMsg := &types.TickMsg{}
+			err = json.Unmarshal([]byte(msg), tickMsg)
+			if err != nil {
+				log.Printf("Listen: malformed tick message")
+				break
+			}
+			c.Msgs <- tickMsg
 		default:
 			log.Printf("Listen: Unkown message type")
 		}
@@ -102,8 +129,9 @@ func (c *Client) ConnectRequest(name string, groupId string,
 	log.Print("Send connect request to server")
 	conReq, err := json.Marshal(types.ConnReqMsg{
 		JsonMsg: &types.JsonMsg{Type: "connect"},
-		Name:    "Wastack",
-		Privacy: "private",
+		Name:    name,
+		GroupId: groupId,
+		Privacy: privacy,
 	})
 	if err != nil {
 		log.Fatal("Failed to marshal connect message")
@@ -111,7 +139,7 @@ func (c *Client) ConnectRequest(name string, groupId string,
 	c.SendMessage(conReq)
 
 	log.Print("Receiving connect response")
-	msg, err := bufio.NewReader(c.conn).ReadString('\n')
+	msg, err := c.reader.ReadString('\n')
 	if err != nil {
 		log.Printf("Connection error: %s", err.Error())
 	}
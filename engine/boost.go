@@ -0,0 +1,32 @@
+package engine
+
+const (
+	// energy of a player at the start of a round
+	maxEnergy = 12
+	// energy used by a single boosted tick
+	boostCost = 4
+	// number of ticks after a boost before energy starts to recharge
+	boostCooldown = 5
+)
+
+// energy is the energy left for boosting.
+func (p playerData) energy() int {
+	return maxEnergy - p.energySpent
+}
+
+// useBoost spends the energy of a boosted tick if the player asked for a
+// boost and has enough energy, otherwise the energy recharges by one after
+// the cooldown. It returns true if the player boosts in this tick.
+func (p *playerData) useBoost(boost bool) bool {
+	if boost && p.energy() >= boostCost {
+		p.energySpent += boostCost
+		p.cooldown = boostCooldown
+		return true
+	}
+	if p.cooldown > 0 {
+		p.cooldown--
+	} else if p.energySpent > 0 {
+		p.energySpent--
+	}
+	return false
+}
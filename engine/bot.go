@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"io"
+	"log"
+	"math/rand"
+	"strings"
+)
+
+// Bot is a computer controlled player. It is asked for a direction at each
+// tick.
+type Bot interface {
+	Decide(v GameView) types.Direction
+}
+
+// GameView is a read-only view of a game from the perspective of a player.
+type GameView struct {
+	state    gameState
+	color    types.PlayerColor
+	occupied map[gui.Position]bool
+}
+
+func newGameView(s gameState, color types.PlayerColor) GameView {
+	v := GameView{
+		state:    s,
+		color:    color,
+		occupied: make(map[gui.Position]bool),
+	}
+	for _, p := range s.players {
+		for _, h := range p.history {
+			v.occupied[h] = true
+		}
+	}
+	return v
+}
+
+func (v GameView) Width() int {
+	return v.state.size.width
+}
+
+func (v GameView) Height() int {
+	return v.state.size.height
+}
+
+func (v GameView) Tick() int {
+	return v.state.tick
+}
+
+// Step returns the cell next to pos in the given direction, taking wrapping
+// walls into account.
+func (v GameView) Step(pos gui.Position, d types.Direction) gui.Position {
+	return v.state.step(pos, d)
+}
+
+// Free tells if a player can step on the cell.
+func (v GameView) Free(pos gui.Position) bool {
+	return !v.state.blocked(pos) && !v.occupied[pos]
+}
+
+func (v GameView) me() playerData {
+	for _, p := range v.state.players {
+		if p.color == v.color {
+			return p
+		}
+	}
+	return playerData{}
+}
+
+// Head is the position of the player's head.
+func (v GameView) Head() gui.Position {
+	h := v.me().history
+	return h[len(h)-1]
+}
+
+// Dir is the current direction of the player.
+func (v GameView) Dir() types.Direction {
+	return v.me().dir
+}
+
+// OpponentHeads are the head positions of the other living players.
+func (v GameView) OpponentHeads() []gui.Position {
+	heads := make([]gui.Position, 0, len(v.state.players))
+	for _, p := range v.state.players {
+		if p.color != v.color && !p.isDead {
+			heads = append(heads, p.history[len(p.history)-1])
+		}
+	}
+	return heads
+}
+
+// starter is implemented by the bots that take time to get ready, like
+// external programs.
+type starter interface {
+	Start(v GameView) error
+}
+
+// startBot gets the bot ready before the first tick of the game.
+func startBot(b Bot, v GameView) {
+	if s, ok := b.(starter); ok {
+		if err := s.Start(v); err != nil {
+			log.Printf("Starting bot: %s", err.Error())
+		}
+	}
+}
+
+// closeBots stops the bots that hold resources, like external programs.
+func closeBots(bots []Bot) {
+	for _, b := range bots {
+		if c, ok := b.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("Closing bot: %s", err.Error())
+			}
+		}
+	}
+}
+
+var allDirections = [...]types.Direction{types.Up, types.Left, types.Down, types.Right}
+
+// safeMoves lists the directions the player can go without dying at the next
+// tick, the current direction first.
+func (v GameView) safeMoves() []types.Direction {
+	dir := v.Dir()
+	moves := make([]types.Direction, 0, len(allDirections))
+	if v.Free(v.Step(v.Head(), dir)) {
+		moves = append(moves, dir)
+	}
+	for _, d := range allDirections {
+		if d != dir && d != dir.Opposite() && v.Free(v.Step(v.Head(), d)) {
+			moves = append(moves, d)
+		}
+	}
+	return moves
+}
+
+//----------------------------------------
+// Strategies
+
+type Difficulty int
+
+const (
+	Easy Difficulty = iota
+	Normal
+	Hard
+)
+
+// chance of a bot making a random safe move instead of following its strategy
+var mistakeChance = [...]float64{Easy: 0.3, Normal: 0.1, Hard: 0}
+
+func ParseDifficulty(s string) (Difficulty, error) {
+	switch strings.ToLower(s) {
+	case "easy":
+		return Easy, nil
+	case "normal":
+		return Normal, nil
+	case "hard":
+		return Hard, nil
+	}
+	return Easy, fmt.Errorf("Unknown difficulty: '%s'", s)
+}
+
+// BotStrategies are the names of the built-in bots.
+var BotStrategies = []string{"random", "wallhugger", "floodfill", "voronoi"}
+
+// NewBot creates one of the built-in bots. The seed makes its random choices
+// reproducible. Strategies starting with "exec:" or "exec-delta:" run an
+// external bot program, see NewExternalBot.
+func NewBot(strategy string, d Difficulty, seed int64) (Bot, error) {
+	if cmd := strings.TrimPrefix(strategy, execPrefix); cmd != strategy {
+		return NewExternalBot(cmd, defaultBotBudget, false)
+	}
+	if cmd := strings.TrimPrefix(strategy, execDeltaPrefix); cmd != strategy {
+		return NewExternalBot(cmd, defaultBotBudget, true)
+	}
+	var score scoreFunc
+	switch strategy {
+	case "random":
+		score = nil
+	case "wallhugger":
+		score = wallScore
+	case "floodfill":
+		score = floodFillScore
+	case "voronoi":
+		score = voronoiScore
+	default:
+		return nil, fmt.Errorf("Unknown bot strategy: '%s'", strategy)
+	}
+	return &scoringBot{
+		score:   score,
+		mistake: mistakeChance[d],
+		rnd:     rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// scoreFunc rates a safe move, the higher the better.
+type scoreFunc func(v GameView, d types.Direction) int
+
+// scoringBot takes the safe move with the best score. Without a score
+// function it picks a random safe move.
+type scoringBot struct {
+	score   scoreFunc
+	mistake float64
+	rnd     *rand.Rand
+}
+
+func (b *scoringBot) Decide(v GameView) types.Direction {
+	moves := v.safeMoves()
+	if len(moves) == 0 {
+		return v.Dir() // nowhere to go
+	}
+	if b.score == nil || b.rnd.Float64() < b.mistake {
+		return moves[b.rnd.Intn(len(moves))]
+	}
+	best, bestScore := moves[0], b.score(v, moves[0])
+	for _, d := range moves[1:] {
+		if s := b.score(v, d); s > bestScore {
+			best, bestScore = d, s
+		}
+	}
+	return best
+}
+
+// wallScore prefers cells next to walls and trails.
+func wallScore(v GameView, d types.Direction) int {
+	target := v.Step(v.Head(), d)
+	blocked := 0
+	for _, n := range allDirections {
+		if !v.Free(v.Step(target, n)) {
+			blocked++
+		}
+	}
+	return blocked
+}
+
+// floodFillScore is the number of cells reachable after the move.
+func floodFillScore(v GameView, d types.Direction) int {
+	start := v.Step(v.Head(), d)
+	seen := map[gui.Position]bool{start: true}
+	queue := []gui.Position{start}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, n := range allDirections {
+			next := v.Step(pos, n)
+			if !seen[next] && v.Free(next) {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return len(seen)
+}
+
+// voronoiScore is the number of cells the player reaches before any of its
+// opponents after the move.
+func voronoiScore(v GameView, d types.Direction) int {
+	mine := distances(v, []gui.Position{v.Step(v.Head(), d)})
+	theirs := distances(v, v.OpponentHeads())
+	count := 0
+	for pos, dist := range mine {
+		// dist is counted from the cell after the move
+		if other, ok := theirs[pos]; !ok || dist+1 < other {
+			count++
+		}
+	}
+	// break ties by the space left
+	return count*v.Width()*v.Height() + floodFillScore(v, d)
+}
+
+// distances runs a breadth-first search from the given cells over free cells.
+func distances(v GameView, from []gui.Position) map[gui.Position]int {
+	dist := make(map[gui.Position]int, len(from))
+	queue := make([]gui.Position, 0, len(from))
+	for _, pos := range from {
+		dist[pos] = 0
+		queue = append(queue, pos)
+	}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, n := range allDirections {
+			next := v.Step(pos, n)
+			if _, ok := dist[next]; !ok && v.Free(next) {
+				dist[next] = dist[pos] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return dist
+}
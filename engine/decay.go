@@ -0,0 +1,82 @@
+package engine
+
+import "github.com/tron_client/gui"
+
+// Trails decay if the rules limit their length or let them fade. The history
+// of a player is then a window sliding over the trail: cells are appended at
+// the head and dropped at the tail.
+
+// minTrailLength is the shortest trail allowed, including the head.
+const minTrailLength = 2
+
+// laidAt returns the tick the i-th cell of the history was laid at. Cells
+// laid before ticks were recorded count as laid at tick 0.
+func (p playerData) laidAt(i int) int {
+	j := i - (len(p.history) - len(p.laid))
+	if j < 0 {
+		return 0
+	}
+	return p.laid[j]
+}
+
+// decays tells if the rules let trails decay.
+func (r gameRules) decays() bool {
+	return r.trailLength > 0 || r.trailFade > 0
+}
+
+// trimTrail drops the cells at the tail of the trail that are beyond the
+// maximum length or older than the fading time, and returns them. The head of
+// a living player is kept, the trail of a dead one fades entirely.
+func (s gameState) trimTrail(p *playerData) []gui.Position {
+	keep := 1
+	if p.isDead {
+		keep = 0
+	}
+	n := 0
+	for len(p.history)-n > keep {
+		tooLong := s.rules.trailLength > 0 && len(p.history)-n > s.rules.trailLength
+		faded := s.rules.trailFade > 0 && p.laidAt(n) <= s.tick-s.rules.trailFade
+		if !tooLong && !faded {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	removed := append([]gui.Position(nil), p.history[:n]...)
+	p.history = p.history[n:]
+	if len(p.laid) > len(p.history) {
+		p.laid = p.laid[len(p.laid)-len(p.history):]
+	}
+	p.trimmed += n
+	return removed
+}
+
+// decay trims the trails of every player and returns the cells freed by the
+// tick. Cells still covered by another trail are not freed.
+func (s *gameState) decay() []gui.Position {
+	if !s.rules.decays() {
+		return nil
+	}
+	var removed []gui.Position
+	for i := range s.players {
+		removed = append(removed, s.trimTrail(&s.players[i])...)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	taken := make(map[gui.Position]bool)
+	for _, p := range s.players {
+		for _, h := range p.history {
+			taken[h] = true
+		}
+	}
+	freed := make([]gui.Position, 0, len(removed))
+	for _, pos := range removed {
+		if !taken[pos] {
+			freed = append(freed, pos)
+		}
+	}
+	return freed
+}
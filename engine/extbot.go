@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	execPrefix      = "exec:"
+	execDeltaPrefix = "exec-delta:"
+	// time an external bot has to answer a tick by default
+	defaultBotBudget = 100 * time.Millisecond
+	// time an external bot program has to load before answering, it is
+	// started before the first tick of the game
+	defaultBotStartup = 2 * time.Second
+)
+
+// ExternalBot runs a bot program in a subprocess. The program receives a
+// "start" message and then a "tick" message for every tick on its standard
+// input, one JSON per line, and answers each tick with a "move" message on
+// its standard output. A bot that does not answer within its budget or sends
+// an invalid move is disqualified. The program may take its startup time to
+// load, the budget applies to the answers after it.
+type ExternalBot struct {
+	command string
+	budget  time.Duration
+	startup time.Duration
+	// delta bots get only the cells added since the last tick
+	delta bool
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+	answers chan string
+	// the program has loaded at ready at the latest
+	ready time.Time
+	// stop is closed by Close, readerDone by the reader of the answers
+	stop       chan bool
+	readerDone chan bool
+	// number of cells laid by the players already sent to the bot, and the
+	// number of cells faded from their tails
+	sent  map[types.PlayerColor]int
+	faded map[types.PlayerColor]int
+
+	// Close may be called while the ticker goroutine is deciding, the
+	// program and the state of the bot are guarded by lock
+	lock         sync.Mutex
+	disqualified bool
+	closed       bool
+}
+
+func NewExternalBot(command string, budget time.Duration, delta bool) (*ExternalBot, error) {
+	if len(strings.Fields(command)) == 0 {
+		return nil, fmt.Errorf("Missing bot program")
+	}
+	return &ExternalBot{
+		command: command,
+		budget:  budget,
+		startup: defaultBotStartup,
+		delta:   delta,
+		sent:    make(map[types.PlayerColor]int),
+		faded:   make(map[types.PlayerColor]int),
+	}, nil
+}
+
+// start launches the program and sends the start message.
+func (b *ExternalBot) start(v GameView) error {
+	args := strings.Fields(b.command)
+	b.cmd = exec.Command(args[0], args[1:]...)
+	stdin, err := b.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := b.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = b.cmd.Start(); err != nil {
+		return err
+	}
+	b.stdin, b.stdout = stdin, stdout
+	b.ready = time.Now().Add(b.startup)
+	b.answers = make(chan string, 1)
+	b.stop = make(chan bool)
+	b.readerDone = make(chan bool)
+	go func(stop chan bool) {
+		defer close(b.readerDone)
+		defer close(b.answers)
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				select {
+				case <-stop:
+				default:
+					log.Printf("External bot: %s", err.Error())
+				}
+				return
+			}
+			select {
+			case b.answers <- line:
+			case <-stop:
+				return
+			}
+		}
+	}(b.stop)
+	start := &types.BotStartMsg{
+		JsonMsg:  &types.JsonMsg{Type: "start"},
+		Width:    v.Width(),
+		Height:   v.Height(),
+		Color:    v.color,
+		BudgetMs: int(b.budget.Milliseconds()),
+		Delta:    b.delta,
+	}
+	if m := v.state.rules.arenaMap; m != nil {
+		start.Obstacles = m.Obstacles
+	}
+	return b.send(start)
+}
+
+func (b *ExternalBot) send(msg types.JsonMsgI) error {
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = b.stdin.Write(append(bytes, '\n'))
+	return err
+}
+
+// Start launches the program and sends the start message unless it is
+// running already. Games start the bots before the first tick, so loading the
+// program is not counted in the budget of the tick.
+func (b *ExternalBot) Start(v GameView) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.cmd != nil || b.disqualified || b.closed {
+		return nil
+	}
+	if err := b.start(v); err != nil {
+		// the bot forfeits the game instead of starting at the first tick
+		b.disqualified = true
+		return fmt.Errorf("External bot '%s' unable to start: %s", b.command, err.Error())
+	}
+	return nil
+}
+
+func (b *ExternalBot) Decide(v GameView) types.Direction {
+	answers, wait, err := b.sendTick(v)
+	if err != nil {
+		return b.disqualify("%s", err.Error())
+	}
+	if answers == nil {
+		return types.Forfeit
+	}
+
+	select {
+	case line, ok := <-answers:
+		if !ok {
+			return b.disqualify("program exited")
+		}
+		move := &types.BotMoveMsg{}
+		if err := json.Unmarshal([]byte(line), move); err != nil || move.JsonMsg == nil ||
+			move.Type != "move" {
+			return b.disqualify("malformed answer: %s", line)
+		}
+		switch move.Dir {
+		case types.Up, types.Down, types.Left, types.Right:
+		default:
+			return b.disqualify("unknown direction: %s", move.Dir)
+		}
+		if move.Dir == v.Dir().Opposite() {
+			return b.disqualify("turning to the opposite direction")
+		}
+		return move.Dir
+	case <-time.After(wait):
+		return b.disqualify("no answer within %d ms", wait.Milliseconds())
+	}
+}
+
+// sendTick sends the tick to the program, starting it if the game did not.
+// It returns the channel of the answers, nil if the bot does not play any
+// more, and the time the bot has to answer.
+func (b *ExternalBot) sendTick(v GameView) (chan string, time.Duration, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.disqualified || b.closed {
+		return nil, 0, nil
+	}
+	if b.cmd == nil {
+		if err := b.start(v); err != nil {
+			return nil, 0, fmt.Errorf("unable to start: %s", err.Error())
+		}
+	}
+	if err := b.send(b.tickMsg(v)); err != nil {
+		return nil, 0, fmt.Errorf("unable to send tick: %s", err.Error())
+	}
+	wait := b.budget
+	if loading := time.Until(b.ready); loading > wait {
+		wait = loading
+	}
+	return b.answers, wait, nil
+}
+
+func (b *ExternalBot) tickMsg(v GameView) *types.BotTickMsg {
+	msg := &types.BotTickMsg{
+		JsonMsg: &types.JsonMsg{Type: "tick"},
+		Tick:    v.Tick(),
+		Players: make([]types.BotPlayer, 0, len(v.state.players)),
+		Items:   v.state.msgItems(),
+	}
+	for _, p := range v.state.players {
+		laid := p.trimmed + len(p.history)
+		from, faded := 0, 0
+		// fewer cells than the sent ones means a new round
+		if b.delta && b.sent[p.color] <= laid {
+			from = b.sent[p.color] - p.trimmed
+			faded = p.trimmed - b.faded[p.color]
+		}
+		if from < 0 {
+			from = 0
+		}
+		b.sent[p.color] = laid
+		b.faded[p.color] = p.trimmed
+		msg.Players = append(msg.Players, types.BotPlayer{
+			Color:   p.color,
+			Dir:     p.dir,
+			Dead:    p.isDead,
+			PowerUp: string(p.powerUp),
+			Trail:   cells(p.history[from:]),
+			Faded:   faded,
+		})
+	}
+	return msg
+}
+
+func cells(positions []gui.Position) []types.Cell {
+	c := make([]types.Cell, len(positions))
+	for i, pos := range positions {
+		c[i] = types.Cell{X: pos.X, Y: pos.Y}
+	}
+	return c
+}
+
+func (b *ExternalBot) disqualify(reason string, args ...interface{}) types.Direction {
+	b.lock.Lock()
+	if b.closed {
+		// the program was stopped by Close
+		b.lock.Unlock()
+		return types.Forfeit
+	}
+	log.Printf("External bot '%s' disqualified: %s", b.command, fmt.Sprintf(reason, args...))
+	b.disqualified = true
+	b.lock.Unlock()
+	b.Close()
+	return types.Forfeit
+}
+
+// Disqualified tells if the bot lost its seat because of misbehaving.
+func (b *ExternalBot) Disqualified() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.disqualified
+}
+
+// Close stops the bot program, the bot forfeits the following ticks.
+func (b *ExternalBot) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	if b.cmd == nil || b.cmd.Process == nil {
+		return nil
+	}
+	close(b.stop)
+	b.stdin.Close()
+	err := b.cmd.Process.Kill()
+	// a child of the program may keep its output open, the reader has to
+	// return before Wait
+	b.stdout.Close()
+	<-b.readerDone
+	// the program was killed, its exit status is not interesting
+	b.cmd.Wait()
+	b.cmd.Process = nil
+	return err
+}
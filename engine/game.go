@@ -6,6 +6,7 @@ import (
 	"github.com/tron_client/gui"
 	"github.com/tron_client/types"
 	"log"
+	"time"
 )
 
 type Size struct {
@@ -15,97 +16,294 @@ type Size struct {
 
 type playerData struct {
 	history []gui.Position
+	// laid holds the tick of the last cells of the history, only recorded if
+	// trails fade. trimmed is the number of cells dropped from the tail.
+	laid    []int
+	trimmed int
 	color   types.PlayerColor
 	isDead  bool
 	dir     types.Direction
 	name    string
+	// team is 0 if the player fights alone
+	team int
+	// deathTick is the tick the player died at
+	deathTick int
+	// killer is the color of the player whose trail killed this player
+	killer types.PlayerColor
+	// powerUp is in effect for powerUpTicks more ticks
+	powerUp      PowerUp
+	powerUpTicks int
+	// energySpent on boosts, it recharges after cooldown ticks
+	energySpent int
+	cooldown    int
 }
 
 func (p *playerData) changeDir(d types.Direction) {
 	if p.dir.Opposite() == d {
 		log.Printf("Trying to turn to opposite direction")
-
+		return
 	}
 	p.dir = d
 }
 
 type Game struct {
-	size    Size
-	players []playerData
+	state gameState
+	// initial is the state the game started from, it is used to rebuild the
+	// board when seeking in a replay
+	initial gameState
+	replay  *Replay
+	// over is set when the current round has ended
+	over bool
+	// match is nil if a single round is played
+	match      *Match
+	breakTicks int
+
+	gameGui   gui.GameGui
+	handler   GameHandler
+	newTicker func(time.Duration) Ticker
+	done      chan bool
+}
+
+// NewGame starts a game. If netw is given, the game is driven by the server
+// and myColor identifies the player of this client, otherwise it is a local
+// game.
+func NewGame(s GameSettings, players []playerData, guik types.GuiKind,
+	netw *client.Client, myColor types.PlayerColor) (*Game, error) {
+	var handler GameHandler
+	var err error
+	if countSides(players) < 2 {
+		return nil, fmt.Errorf("At least two teams are needed")
+	}
+	if s.Map != nil {
+		s.Width, s.Height = s.Map.Width, s.Map.Height
+		if netw == nil {
+			if players, err = placeOnSpawns(s.Map, players); err != nil {
+				return nil, err
+			}
+		}
+	}
+	game := newGame(s.Width, s.Height, players, guik)
+	rules := newGameRules(s.Walls, s.ShrinkEvery, s.Map)
+	rules.powerUps = s.PowerUps
+	rules.seed = s.Seed
+	rules.teamPassable = s.TeamPassable
+	rules.suddenDeath = s.SuddenDeath
+	rules.trailLength = s.TrailLength
+	rules.trailFade = s.TrailFade
+	rules.tickTime = s.TickTime
+	rules.speedUp = s.SpeedUp
+	game.setRules(rules)
+	game.replay = NewReplay(game.state)
+	if s.WinsNeeded > 0 && netw == nil {
+		game.match = NewMatch(players, s.WinsNeeded)
+	}
+	if netw != nil {
+		var bot Bot
+		if len(s.Bots) > 0 {
+			bot = s.Bots[0]
+		}
+		handler, err = NewNetGameHandler(game, netw, myColor, s.KeyBindings[0], bot, s.MaxTurns)
+	} else {
+		handler, err = NewLocalGameHandler(game, s.KeyBindings, s.Bots, s.MaxTurns)
+	}
+	if err != nil {
+		game.gameGui.Close()
+		return nil, err
+	}
+	game.handler = handler
+	game.start()
+	return game, nil
+}
 
-	gameGui gui.GameGui
-	handler GameHandler
+// NewReplayGame plays back a recorded game instead of listening to players.
+func NewReplayGame(r *Replay, guik types.GuiKind) *Game {
+	game := newGame(r.Width, r.Height, r.startingPlayers(), guik)
+	game.setRules(r.rules())
+	game.handler = NewReplayGameHandler(game, r)
+	game.start()
+	return game
 }
 
-func NewGame(w int, h int, players []playerData, guik types.GuiKind, netw *client.Client) *Game {
+func newGame(w int, h int, players []playerData, guik types.GuiKind) *Game {
 	var gameGui gui.GameGui
 	switch guik {
 	case types.NCursesGame:
 		gameGui = gui.NewNCurseGame(w, h)
 	case types.Headless:
-		// TODO
+		gameGui = gui.NewHeadlessGame(w, h)
 	}
-	game := &Game{
+	state := gameState{
 		size:    Size{width: w, height: h},
-		players: players,
-		gameGui: gameGui,
+		players: copyPlayers(players),
 	}
-	if netw != nil {
-		game.handler = NewNetGameHandler(game, netw)
-	} else {
-		game.handler = NewLocalGameHandler(game)
+	game := &Game{
+		state:     state,
+		initial:   state,
+		gameGui:   gameGui,
+		newTicker: newWallTicker,
+		done:      make(chan bool),
 	}
 
 	// set initial positions on GUI
-	blocks := make([]gui.PlayerBlock, 0, len(players))
-	for _, p := range players {
+	game.redraw()
+	return game
+}
+
+// setRules sets the rules of the game before it starts.
+func (g *Game) setRules(r gameRules) {
+	g.state.rules = r
+	g.initial.rules = r
+	g.redraw()
+}
+
+func (g *Game) start() {
+	// start listening to server and user actions
+	go func() {
+		g.handler.ListenInput()
+		close(g.done)
+	}()
+}
+
+// Wait blocks until the game handler stops listening to input.
+func (g *Game) Wait() {
+	<-g.done
+}
+
+func (g *Game) Close() {
+	g.handler.Close()
+	g.gameGui.Close()
+}
+
+func (g *Game) Replay() *Replay {
+	return g.replay
+}
+
+// Step advances the game by one tick using the players' inputs and draws the
+// result. It returns true if the round is over.
+func (g *Game) Step(in inputs) bool {
+	if g.over {
+		g.waitNextRound()
+		return g.over
+	}
+	if g.replay != nil {
+		g.replay.AddTick(in)
+	}
+	var new_blocks []gui.PlayerBlock
+	var freed []gui.Position
+	inset := g.state.inset()
+	items := g.state.items
+	g.state, new_blocks, freed = simulate(g.state, in)
+
+	g.gameGui.BeginFrame()
+	if g.state.inset() != inset {
+		g.gameGui.SetBorder(g.state.border())
+	}
+	for _, pos := range freed {
+		g.gameGui.ClearCell(pos)
+	}
+	// picked up items are cleared before the blocks are drawn on them
+	g.drawItems(items, g.state.items)
+	for _, b := range new_blocks {
+		g.gameGui.SetCell(b.Pos, blockCell(b))
+	}
+	g.drawHeads()
+	g.gameGui.SetStatus(g.state.status())
+	g.gameGui.EndFrame()
+
+	g.over = g.state.isOver()
+	if g.over {
+		g.endRound()
+	}
+	return g.over
+}
+
+// endRound shows the result of the round, or the scoreboard if the game is
+// part of a match.
+func (g *Game) endRound() {
+	if g.match == nil {
+		g.showResult()
+		return
+	}
+	g.match.addRound(g.state)
+	g.gameGui.ShowScoreboard(g.match.scoreboard())
+	g.breakTicks = roundBreakTicks
+}
+
+// waitNextRound counts down the break between two rounds of a match and
+// starts the next round.
+func (g *Game) waitNextRound() {
+	if g.match == nil || g.match.Finished() {
+		return
+	}
+	g.breakTicks--
+	if g.breakTicks > 0 {
+		return
+	}
+	// every round has its own replay and items
+	g.state = g.initial
+	g.state.rules.seed += int64(g.match.round)
+	g.over = false
+	if g.replay != nil {
+		g.replay = NewReplay(g.state)
+	}
+	g.redraw()
+}
+
+func (g *Game) Match() *Match {
+	return g.match
+}
+
+// showResult shows the winner of a finished round, it is a draw if nobody
+// is alive.
+func (g *Game) showResult() {
+	g.gameGui.SetWin(g.state.winnerName())
+}
+
+// seek rebuilds the game from its initial state up to the given tick using
+// the recorded inputs.
+func (g *Game) seek(tick int, r *Replay) {
+	g.state = g.initial
+	for g.state.tick < tick && g.state.tick < len(r.Ticks) {
+		g.state, _, _ = simulate(g.state, r.inputs(g.state.tick))
+	}
+	g.redraw()
+	g.over = g.state.isOver()
+	if g.over {
+		g.showResult()
+	}
+}
+
+// blocks returns every block currently on the board.
+func (g *Game) blocks() []gui.PlayerBlock {
+	blocks := make([]gui.PlayerBlock, 0, len(g.state.players))
+	for _, p := range g.state.players {
 		for _, h := range p.history {
 			blocks = append(blocks, gui.PlayerBlock{
 				Pos:   gui.Position{X: h.X, Y: h.Y},
 				Color: p.color,
+				Team:  p.team,
 			})
 		}
-
 	}
-	gameGui.AppendBlocks(blocks)
-
-	// start listening to server and user actions
-	go game.handler.ListenInput()
-	return game
+	return blocks
 }
 
-func (g *Game) Step() bool {
-	new_blocks := make([]gui.PlayerBlock, 0, len(g.players))
-
-	// holds last alive player observerd. It is needed outside the loop in
-	// case there is a winner
-	var e *playerData
-
-	for i := range g.players {
-		e = &g.players[i]
-		if e.isDead { // dead player won't step
-			continue
-		}
-		head := e.history[len(e.history)-1]
-		new_pos := move(head, e.dir)
-		if new_pos.X < 0 || new_pos.X >= g.size.width ||
-			new_pos.Y < 0 || new_pos.Y >= g.size.height {
-			e.isDead = true
-		} else {
-			e.history = append(e.history, new_pos)
-			new_blocks = append(new_blocks,
-				gui.PlayerBlock{
-					Pos:   new_pos,
-					Color: e.color,
-				})
-		}
+func copyPlayers(players []playerData) []playerData {
+	c := make([]playerData, len(players))
+	for i, p := range players {
+		c[i] = p
+		c[i].history = append([]gui.Position(nil), p.history...)
+		c[i].laid = append([]int(nil), p.laid...)
 	}
-	if len(new_blocks) == 0 {
-		g.gameGui.SetWin("") // it is draw
-	} else if len(new_blocks) == 1 {
-		g.gameGui.SetWin(e.name) // there is a winner
+	return c
+}
+
+// isDirection tells if the direction is one move() can step to.
+func isDirection(d types.Direction) bool {
+	switch d {
+	case types.Up, types.Down, types.Left, types.Right:
+		return true
 	}
-	g.gameGui.AppendBlocks(new_blocks)
 	return false
 }
 
@@ -125,9 +323,9 @@ func move(pos gui.Position, dir types.Direction) gui.Position {
 }
 
 func (g *Game) playerByColor(c types.PlayerColor) (*playerData, error) {
-	for i := range g.players {
-		if c == g.players[i].color {
-			return &g.players[i], nil
+	for i := range g.state.players {
+		if c == g.state.players[i].color {
+			return &g.state.players[i], nil
 		}
 	}
 	return nil, fmt.Errorf("Unable to find player color")
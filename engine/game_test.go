@@ -0,0 +1,695 @@
+package engine
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tron_client/client"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeadlessGameStep(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{
+			history: []gui.Position{{X: 0, Y: 0}},
+			color:   "#FF0000",
+			dir:     types.Right,
+			name:    "Piros",
+		},
+		{
+			history: []gui.Position{{X: 4, Y: 4}},
+			color:   "#00FF00",
+			dir:     types.Right,
+			name:    "Zold",
+		},
+	}
+	game := newGame(5, 5, players, types.Headless)
+	headless := game.gameGui.(*gui.HeadlessGame)
+
+	assert.Equal(types.PlayerColor("#FF0000"), headless.Cell(0, 0))
+	assert.Equal(types.PlayerColor("#00FF00"), headless.Cell(4, 4))
+	_, over := headless.Winner()
+	assert.False(over)
+
+	// green runs into the wall, red is the only one stepping
+	game.Step(inputs{})
+	assert.Equal(types.PlayerColor("#FF0000"), headless.Cell(1, 0))
+	assert.True(game.state.players[1].isDead)
+	winner, over := headless.Winner()
+	assert.True(over)
+	assert.Equal("Piros", winner)
+
+	assert.Equal(2, headless.FrameCount())
+	assert.Equal("00...\n.....\n.....\n.....\n....1\n", headless.Frame())
+}
+
+func TestSimulateCollisions(t *testing.T) {
+	assert := assert.New(t)
+	state := gameState{
+		size: Size{width: 5, height: 5},
+		players: []playerData{
+			{history: []gui.Position{{X: 0, Y: 2}}, color: "a", dir: types.Right},
+			{history: []gui.Position{{X: 4, Y: 2}}, color: "b", dir: types.Left},
+			{history: []gui.Position{{X: 3, Y: 0}, {X: 3, Y: 1}}, color: "c", dir: types.Up},
+		},
+	}
+
+	// c turns back to its own trail, which is ignored
+	next, blocks, _ := simulate(state, inputs{"c": {dir: types.Down}})
+	assert.Equal(1, next.tick)
+	assert.Equal(2, len(blocks))
+	assert.True(next.players[2].isDead) // runs into its own trail
+	assert.Equal(types.Direction(types.Up), next.players[2].dir)
+	// the previous state is untouched
+	assert.Equal(1, len(state.players[0].history))
+	assert.False(state.players[2].isDead)
+
+	// a and b reach the same cell at the same time
+	next, blocks, _ = simulate(next, inputs{})
+	assert.Equal(0, len(blocks))
+	assert.True(next.players[0].isDead)
+	assert.True(next.players[1].isDead)
+}
+
+func TestSimulateManyTicks(t *testing.T) {
+	assert := assert.New(t)
+	const width = 3000
+	state := gameState{
+		size: Size{width: width, height: 1},
+		players: []playerData{
+			{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Right},
+		},
+	}
+	for i := 1; i < width; i++ {
+		state, _, _ = simulate(state, inputs{})
+		assert.False(state.players[0].isDead)
+	}
+	assert.Equal(width, len(state.players[0].history))
+
+	// next step runs into the wall
+	state, _, _ = simulate(state, inputs{})
+	assert.True(state.players[0].isDead)
+	assert.Equal(width, state.tick)
+}
+
+func TestInputQueueDoubleTurn(t *testing.T) {
+	assert := assert.New(t)
+	q := newInputQueue(types.Right, 2)
+
+	// U-turn: up then left, left is only valid after up
+	assert.True(q.push(types.Up))
+	assert.True(q.push(types.Left))
+	// queue is full
+	assert.False(q.push(types.Down))
+
+	d, ok := q.pop()
+	assert.True(ok)
+	assert.Equal(types.Direction(types.Up), d)
+	// reversing the queued left turn is rejected
+	assert.False(q.push(types.Right))
+	d, _ = q.pop()
+	assert.Equal(types.Direction(types.Left), d)
+	_, ok = q.pop()
+	assert.False(ok)
+}
+
+func TestValidateKeyBindings(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(validateKeyBindings(DefaultKeyBindings, 4))
+	assert.NotNil(validateKeyBindings(DefaultKeyBindings, 5))
+	assert.NotNil(validateKeyBindings(DefaultKeyBindings[:2], 3))
+
+	// 'w' is already used by the second player
+	conflicting, err := ParseKeyBinding("ijkw")
+	assert.Nil(err)
+	assert.NotNil(validateKeyBindings([]KeyBinding{ArrowKeys, WASDKeys, conflicting}, 3))
+
+	_, err = ParseKeyBinding("iikl")
+	assert.NotNil(err)
+	_, err = ParseKeyBinding("ijkli")
+	assert.NotNil(err)
+
+	// the fifth key is the action key, not a direction
+	b, err := ParseKeyBinding("ijklo")
+	assert.Nil(err)
+	assert.Equal(gui.PlayerKey('o'), b.Action)
+	assert.Equal(4, len(b.Dirs))
+	assert.True(b.isAction('o'))
+	b, err = ParseKeyBinding("ijkl")
+	assert.Nil(err)
+	assert.False(b.isAction(0))
+	// the action key cannot be taken by another player
+	assert.NotNil(validateKeyBindings([]KeyBinding{WASDKeys, {Dirs: b.Dirs, Action: 'w'}}, 2))
+}
+
+func TestMatchRounds(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Right, name: "A"},
+		{history: []gui.Position{{X: 4, Y: 4}}, color: "b", dir: types.Right, name: "B"},
+	}
+	game := newGame(5, 5, players, types.Headless)
+	game.match = NewMatch(players, 2)
+	headless := game.gameGui.(*gui.HeadlessGame)
+
+	// b runs into the wall in every round
+	assert.True(game.Step(inputs{}))
+	assert.False(game.match.Finished())
+	assert.Equal("Round 1 winner: A", headless.Scoreboard()[0])
+
+	// the break between the rounds
+	for i := 1; i < roundBreakTicks; i++ {
+		assert.True(game.Step(inputs{}))
+	}
+	assert.False(game.Step(inputs{}))
+	assert.Equal(0, game.state.tick)
+
+	assert.True(game.Step(inputs{}))
+	assert.True(game.match.Finished())
+	assert.Equal("1. A: 2 wins, 2 points, 0 kills", game.match.Standings()[0])
+	assert.Equal("2. B: 0 wins, 0 points, 0 kills", game.match.Standings()[1])
+}
+
+func TestBotsAvoidCrashing(t *testing.T) {
+	assert := assert.New(t)
+	state := gameState{
+		size: Size{width: 10, height: 10},
+		players: []playerData{
+			// heading to the right wall, the cells above are taken
+			{history: []gui.Position{{X: 9, Y: 3}, {X: 9, Y: 4}, {X: 8, Y: 5}, {X: 9, Y: 5}}, color: "a", dir: types.Right},
+			{history: []gui.Position{{X: 0, Y: 0}}, color: "b", dir: types.Down},
+		},
+	}
+	for _, strategy := range BotStrategies {
+		bot, err := NewBot(strategy, Hard, 1)
+		assert.Nil(err)
+		assert.Equal(types.Direction(types.Down), bot.Decide(newGameView(state, "a")), strategy)
+	}
+	_, err := NewBot("unknown", Hard, 1)
+	assert.NotNil(err)
+}
+
+func TestTournamentIsDeterministic(t *testing.T) {
+	assert := assert.New(t)
+	settings := TournamentSettings{
+		Bots:            []string{"random", "floodfill", "voronoi"},
+		Format:          Swiss,
+		Rounds:          2,
+		GamesPerPairing: 2,
+		Width:           15,
+		Height:          10,
+		Seed:            42,
+	}
+	first, err := RunTournament(settings)
+	assert.Nil(err)
+	second, err := RunTournament(settings)
+	assert.Nil(err)
+	assert.Equal(first.Standings(), second.Standings())
+	assert.Equal(first.WinMatrix(), second.WinMatrix())
+	// one bot sits out each round
+	assert.Equal(2*settings.GamesPerPairing, len(first.games))
+}
+
+func TestWallModes(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 4, Y: 2}}, color: "a", dir: types.Right},
+		{history: []gui.Position{{X: 1, Y: 1}}, color: "b", dir: types.Down},
+	}
+
+	// wrapping walls
+	state := gameState{size: Size{width: 5, height: 5}, players: players,
+		rules: gameRules{walls: WrapWalls}}
+	state, _, _ = simulate(state, inputs{})
+	assert.False(state.players[0].isDead)
+	assert.Equal(gui.Position{X: 0, Y: 2}, state.players[0].history[1])
+
+	// shrinking walls close in at the second tick, catching b at the edge
+	state = gameState{size: Size{width: 5, height: 5}, players: players,
+		rules: gameRules{walls: ShrinkingWalls, shrinkEvery: 2}}
+	game := newGame(5, 5, players, types.Headless)
+	game.setRules(state.rules)
+	game.state.players[0].dir = types.Left
+	game.Step(inputs{})
+	assert.Equal(0, game.state.inset())
+	game.Step(inputs{"b": {dir: types.Left}})
+	assert.Equal(1, game.state.inset())
+	assert.True(game.state.players[1].isDead)
+	assert.False(game.state.players[0].isDead)
+	assert.Equal("#####\n#1..#\n#100#\n#...#\n#####\n", game.gameGui.(*gui.HeadlessGame).Frame())
+
+	// the wall passes over a player stepping inward at the same tick
+	state = gameState{tick: 1, size: Size{width: 5, height: 5}, rules: gameRules{walls: ShrinkingWalls, shrinkEvery: 2},
+		players: []playerData{
+			{history: []gui.Position{{X: 0, Y: 2}}, color: "a", dir: types.Right},
+			{history: []gui.Position{{X: 3, Y: 3}}, color: "b", dir: types.Up},
+		}}
+	state, _, _ = simulate(state, inputs{})
+	assert.Equal(1, state.inset())
+	assert.True(state.players[0].isDead)
+	assert.Equal(1, len(state.players[0].history))
+	assert.False(state.players[1].isDead)
+}
+
+func TestMaps(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range BundledMaps() {
+		_, err := LoadMap(name)
+		assert.NoError(err, name)
+	}
+
+	// the spawn on the right is walled in
+	walled := "..........\n" +
+		"..........\n" +
+		".>......#.\n" +
+		".......#<#\n" +
+		"........#.\n" +
+		"..........\n" +
+		"..........\n" +
+		"..........\n" +
+		"..........\n" +
+		"..........\n"
+	_, err := ParseMap("walled", []byte(walled))
+	assert.Error(err)
+	_, err = ParseMap("overlap", []byte(`{"width": 10, "height": 10,
+		"obstacles": [{"x": 1, "y": 1}],
+		"spawns": [{"position": {"x": 1, "y": 1}, "direction": "up"},
+			{"position": {"x": 5, "y": 5}, "direction": "up"}]}`))
+	assert.Error(err)
+
+	// players die on obstacles
+	m, err := ParseMap("pillar", []byte(strings.Replace(walled, "#<#", ".<.", 1)))
+	assert.NoError(err)
+	players, err := placeOnSpawns(m, []playerData{{color: "a"}, {color: "b"}})
+	assert.NoError(err)
+	game := newGame(m.Width, m.Height, players, types.Headless)
+	game.setRules(newGameRules(SolidWalls, 0, m))
+	game.Step(inputs{"b": {dir: types.Up}})
+	assert.True(game.state.players[1].isDead)
+	assert.Equal(types.PlayerColor(""), game.state.players[1].killer)
+	frame := game.gameGui.(*gui.HeadlessGame).Frame()
+	assert.Equal(byte('#'), frame[2*(m.Width+1)+8])
+}
+
+func TestPowerUps(t *testing.T) {
+	assert := assert.New(t)
+	// b's trail blocks the row of a
+	players := []playerData{
+		{history: []gui.Position{{X: 1, Y: 5}}, color: "a", dir: types.Right},
+		{history: []gui.Position{{X: 3, Y: 3}, {X: 3, Y: 4}, {X: 3, Y: 5}, {X: 3, Y: 6}},
+			color: "b", dir: types.Down},
+	}
+	for kind, alive := range map[PowerUp]bool{"": false, SpeedBoost: false, Jump: true, Ghost: true} {
+		state := gameState{size: Size{width: 10, height: 10}, players: copyPlayers(players),
+			items: []item{{pos: gui.Position{X: 2, Y: 5}, kind: kind}}}
+		if kind == "" {
+			state.items = nil
+		}
+		state, _, _ = simulate(state, inputs{})
+		assert.Equal(kind, state.players[0].powerUp)
+		state, _, _ = simulate(state, inputs{})
+		assert.Equal(alive, !state.players[0].isDead, kind)
+	}
+
+	// the same seed spawns the same items
+	state := gameState{size: Size{width: 10, height: 10}, players: players,
+		rules: gameRules{powerUps: true, seed: 7}}
+	for i := 0; i < powerUpEvery; i++ {
+		state, _, _ = simulate(state, inputs{})
+	}
+	again := gameState{size: Size{width: 10, height: 10}, players: players,
+		rules: gameRules{powerUps: true, seed: 7}}
+	for i := 0; i < powerUpEvery; i++ {
+		again, _, _ = simulate(again, inputs{})
+	}
+	assert.Len(state.items, 1)
+	assert.Equal(state.items, again.items)
+}
+
+func TestBoost(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Right},
+		{history: []gui.Position{{X: 0, Y: 9}}, color: "b", dir: types.Right},
+	}
+	state := gameState{size: Size{width: 20, height: 10}, players: players}
+	boost := inputs{"a": {boost: true}}
+
+	// three boosted ticks use up the energy
+	for i := 0; i < 3; i++ {
+		state, _, _ = simulate(state, boost)
+	}
+	a := state.players[0]
+	assert.Equal(gui.Position{X: 6, Y: 0}, a.history[len(a.history)-1])
+	assert.Equal(0, a.energy())
+
+	// energy recharges after the cooldown
+	for i := 0; i < boostCooldown+boostCost; i++ {
+		state, _, _ = simulate(state, inputs{})
+	}
+	assert.Equal(boostCost, state.players[0].energy())
+
+	// the cell passed by the boost is checked for collisions
+	state.players[1].history = append([]gui.Position{{X: 19, Y: 0}}, state.players[1].history...)
+	state.players[0].history = append(state.players[0].history, gui.Position{X: 17, Y: 0})
+	state, _, _ = simulate(state, boost)
+	assert.True(state.players[0].isDead)
+	assert.Equal(types.PlayerColor("b"), state.players[0].killer)
+}
+
+func TestTeams(t *testing.T) {
+	assert := assert.New(t)
+	// a crosses the trail of its teammate b, c and d play against them
+	players := []playerData{
+		{history: []gui.Position{{X: 1, Y: 5}}, color: "a", name: "A", team: 1, dir: types.Right},
+		{history: []gui.Position{{X: 2, Y: 4}, {X: 2, Y: 5}, {X: 2, Y: 6}}, color: "b", name: "B",
+			team: 1, dir: types.Down},
+		{history: []gui.Position{{X: 8, Y: 1}}, color: "c", name: "C", team: 2, dir: types.Up},
+		{history: []gui.Position{{X: 8, Y: 8}}, color: "d", name: "D", team: 2, dir: types.Left},
+	}
+	state := gameState{size: Size{width: 10, height: 10}, players: players,
+		rules: gameRules{teamPassable: true}}
+	state, _, _ = simulate(state, inputs{})
+	assert.False(state.players[0].isDead)
+	state.rules.teamPassable = false
+	state, _, _ = simulate(state, inputs{})
+	assert.False(state.players[0].isDead)
+	assert.True(state.players[2].isDead)
+	assert.False(state.isOver())
+
+	// b runs into the wall and d into the trail of b, the team of a and b
+	// wins together
+	game := newGame(10, 10, state.players, types.Headless)
+	game.state.tick = state.tick
+	game.match = NewMatch(players, 2)
+	for !game.Step(inputs{}) {
+	}
+	assert.Equal("Team 1 (A, B)", game.state.winnerName())
+	assert.Equal([]string{"1. A: 1 wins, 3 points, 0 kills", "2. B: 1 wins, 2 points, 1 kills",
+		"3. D: 0 wins, 2 points, 0 kills", "4. C: 0 wins, 0 points, 0 kills"}, game.match.Standings())
+}
+
+func TestSpeedUpAndSuddenDeath(t *testing.T) {
+	assert := assert.New(t)
+	schedule := TickSchedule{Every: 10, Percent: 10, Min: 300 * time.Millisecond}
+	assert.Equal(400*time.Millisecond, schedule.at(400*time.Millisecond, 9))
+	assert.Equal(360*time.Millisecond, schedule.at(400*time.Millisecond, 10))
+	assert.Equal(300*time.Millisecond, schedule.at(400*time.Millisecond, 1000))
+
+	// the walls close in from tick 4, catching the player at the edge
+	state := gameState{size: Size{width: 10, height: 10},
+		players: []playerData{
+			{history: []gui.Position{{X: 5, Y: 5}}, color: "a", dir: types.Up},
+			{history: []gui.Position{{X: 0, Y: 9}}, color: "b", dir: types.Up},
+		},
+		rules: gameRules{suddenDeath: 4}}
+	for i := 0; i < 3; i++ {
+		state, _, _ = simulate(state, inputs{})
+	}
+	assert.Equal(0, state.inset())
+	assert.False(state.players[1].isDead)
+	state, _, _ = simulate(state, inputs{})
+	assert.Equal(1, state.inset())
+	assert.True(state.players[1].isDead)
+	assert.False(state.players[0].isDead)
+}
+
+func TestTrailDecay(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Right},
+		{history: []gui.Position{{X: 0, Y: 4}}, color: "b", dir: types.Right},
+	}
+
+	// snakes of three cells free their tails
+	game := newGame(6, 5, players, types.Headless)
+	game.setRules(gameRules{trailLength: 3})
+	for i := 0; i < 4; i++ {
+		game.Step(inputs{})
+	}
+	assert.Equal([]gui.Position{{X: 2, Y: 0}, {X: 3, Y: 0}, {X: 4, Y: 0}}, game.state.players[0].history)
+	assert.Equal("..000.\n......\n......\n......\n..111.\n", game.gameGui.(*gui.HeadlessGame).Frame())
+
+	// trails fade after two ticks, the cell freed can be crossed again
+	state := gameState{size: Size{width: 6, height: 5}, players: players,
+		rules: gameRules{trailFade: 2}}
+	state, _, _ = simulate(state, inputs{})
+	state, _, freed := simulate(state, inputs{"a": {dir: types.Down}})
+	assert.Equal([]gui.Position{{X: 0, Y: 0}, {X: 0, Y: 4}}, freed)
+	state, _, _ = simulate(state, inputs{"a": {dir: types.Left}})
+	state, _, _ = simulate(state, inputs{"a": {dir: types.Up}})
+	assert.False(state.players[0].isDead)
+	assert.Equal(gui.Position{X: 0, Y: 0}, state.players[0].history[len(state.players[0].history)-1])
+}
+
+func TestGuiFrames(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Right, name: "A"},
+		{history: []gui.Position{{X: 0, Y: 2}}, color: "b", dir: types.Right, name: "B"},
+	}
+	game := newGame(4, 3, players, types.Headless)
+	headless := game.gameGui.(*gui.HeadlessGame)
+	assert.Equal([]string{"0 A", "1 B"}, headless.Legend())
+	game.Step(inputs{"a": {boost: true}})
+	head, ok := headless.Head("a")
+	assert.True(ok)
+	assert.Equal(gui.Position{X: 2, Y: 0}, head)
+	assert.Equal("Tick 1  A [==-]  B [===]", headless.Status())
+
+	// the result is shown over the board, which is kept
+	game.Step(inputs{"a": {boost: true}})
+	_, ok = headless.Head("a")
+	assert.False(ok)
+	assert.Equal([]string{"Winner is: B"}, headless.Overlay())
+	assert.Equal(3, headless.FrameCount())
+	frames := headless.Frames()
+	assert.Equal(3, len(frames))
+	// A boosts two cells in the first tick
+	assert.Equal("000.\n....\n11..\n", frames[1])
+	assert.Equal("0000\n....\n111.\n", headless.Frame())
+}
+
+func TestReplaySaveLoadAndSeek(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 1, Y: 1}}, color: "#FF0000", dir: types.Right, name: "a"},
+		{history: []gui.Position{{X: 8, Y: 8}}, color: "#00FF00", dir: types.Left, name: "b"},
+	}
+	game := newGame(10, 10, players, types.Headless)
+	game.replay = NewReplay(game.state)
+	turns := map[int]inputs{
+		2: {"#FF0000": {dir: types.Down}},
+		4: {"#00FF00": {dir: types.Up}},
+		6: {"#00FF00": {dir: types.Right}},
+	}
+	states := []gameState{game.state}
+	lastFrame := func(g *Game) string {
+		return g.gameGui.(*gui.HeadlessGame).Frame()
+	}
+	frames := []string{lastFrame(game)}
+	for tick := 0; tick < 8; tick++ {
+		assert.False(game.Step(turns[tick]))
+		states = append(states, game.state)
+		frames = append(frames, lastFrame(game))
+	}
+
+	path := t.TempDir() + "/replay.json"
+	assert.NoError(game.Replay().Save(path))
+	r, err := LoadReplay(path)
+	assert.NoError(err)
+	assert.Equal(game.Replay(), r)
+
+	// seeking forward and back rebuilds the board of the recorded game
+	replay := newGame(r.Width, r.Height, r.startingPlayers(), types.Headless)
+	replay.setRules(r.rules())
+	for _, tick := range []int{8, 3, 5, 0} {
+		replay.seek(tick, r)
+		assert.Equal(states[tick].players, replay.state.players, "tick %d", tick)
+		assert.Equal(frames[tick], lastFrame(replay), "tick %d", tick)
+	}
+
+	// broken replays are refused
+	for name, broken := range map[string]func(r *Replay){
+		"size":      func(r *Replay) { r.Width = 0 },
+		"history":   func(r *Replay) { r.Players[0].History = nil },
+		"outside":   func(r *Replay) { r.Players[1].History[0].X = 10 },
+		"direction": func(r *Replay) { r.Ticks[2][0].Dir = "sideways" },
+		"player":    func(r *Replay) { r.Ticks[4][0].Color = "#0000FF" },
+	} {
+		r, err := LoadReplay(path)
+		assert.NoError(err)
+		broken(r)
+		assert.Error(r.validate(), name)
+	}
+}
+
+// manualTicker ticks when the test sends on c.
+type manualTicker struct {
+	c       chan time.Time
+	stopped bool
+}
+
+func (t *manualTicker) C() <-chan time.Time   { return t.c }
+func (t *manualTicker) Reset(d time.Duration) {}
+func (t *manualTicker) Stop()                 { t.stopped = true }
+
+// closingBot counts its decisions and how many times it was closed.
+type closingBot struct {
+	decisions int
+	closed    int
+}
+
+func (b *closingBot) Decide(v GameView) types.Direction {
+	b.decisions++
+	return v.Dir()
+}
+
+func (b *closingBot) Close() error {
+	b.closed++
+	return nil
+}
+
+func TestLocalGameClose(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Down, name: "A"},
+		{history: []gui.Position{{X: 9, Y: 9}}, color: "b", dir: types.Up, name: "B"},
+	}
+	game := newGame(10, 10, players, types.Headless)
+	ticker := &manualTicker{c: make(chan time.Time)}
+	game.newTicker = func(time.Duration) Ticker { return ticker }
+	bot := &closingBot{}
+	handler, err := NewLocalGameHandler(game, []KeyBinding{WASDKeys}, []Bot{nil, bot}, 0)
+	assert.Nil(err)
+	game.handler = handler
+	game.start()
+
+	// the second tick is received after the first one is drawn
+	ticker.c <- time.Now()
+	ticker.c <- time.Now()
+	headless := game.gameGui.(*gui.HeadlessGame)
+	headless.Input <- gui.Key_q
+	game.Wait()
+	game.Close()
+
+	// ticking has stopped before the window is closed, the bot is closed
+	// once
+	assert.True(ticker.stopped)
+	frames := headless.FrameCount()
+	select {
+	case ticker.c <- time.Now():
+		t.Error("ticking after the game is closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	assert.Equal(frames, headless.FrameCount())
+	assert.True(bot.decisions >= 1)
+	assert.Equal(1, bot.closed)
+	handler.Close()
+	assert.Equal(1, bot.closed)
+}
+
+func TestExternalBot(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	// the programs run the setup, then answer every tick with the given line
+	program := func(name string, setup string, answer string) string {
+		path := dir + "/" + name
+		script := setup + "\nwhile read line; do case \"$line\" in *'\"tick\"'*) " + answer + ";; esac; done\n"
+		assert.Nil(os.WriteFile(path, []byte(script), 0644))
+		return "sh " + path
+	}
+	down := `echo '{"type":"move","direction":"down"}'`
+	state := gameState{
+		size: Size{width: 10, height: 10},
+		players: []playerData{
+			{history: []gui.Position{{X: 1, Y: 1}}, color: "a", dir: types.Right},
+			{history: []gui.Position{{X: 8, Y: 8}}, color: "b", dir: types.Left},
+		},
+	}
+	view := newGameView(state, "a")
+
+	valid, err := NewExternalBot(program("valid", "", down), time.Second, false)
+	assert.Nil(err)
+	assert.Nil(valid.Start(view))
+	assert.Equal(types.Direction(types.Down), valid.Decide(view))
+	assert.Equal(types.Direction(types.Down), valid.Decide(view))
+	assert.False(valid.Disqualified())
+	assert.Nil(valid.Close())
+	// a closed bot forfeits without being disqualified
+	assert.Equal(types.Direction(types.Forfeit), valid.Decide(view))
+	assert.False(valid.Disqualified())
+
+	// loading the program is not counted in the budget of the first tick
+	loading, err := NewExternalBot(program("loading", "sleep 0.3", down), 50*time.Millisecond, false)
+	assert.Nil(err)
+	assert.Nil(loading.Start(view))
+	assert.Equal(types.Direction(types.Down), loading.Decide(view))
+	assert.False(loading.Disqualified())
+	assert.Nil(loading.Close())
+
+	slow, err := NewExternalBot(program("slow", "", "sleep 1"), 50*time.Millisecond, false)
+	assert.Nil(err)
+	slow.startup = 0
+	assert.Equal(types.Direction(types.Forfeit), slow.Decide(view))
+	assert.True(slow.Disqualified())
+	assert.Equal(types.Direction(types.Forfeit), slow.Decide(view))
+
+	invalid, err := NewExternalBot(program("invalid", "", `echo '{"type":"move","direction":"left"}'`), time.Second, false)
+	assert.Nil(err)
+	// turning back is not a valid move
+	assert.Equal(types.Direction(types.Forfeit), invalid.Decide(view))
+	assert.True(invalid.Disqualified())
+	assert.Nil(invalid.Close())
+
+	missing, err := NewExternalBot(dir+"/missing", time.Second, false)
+	assert.Nil(err)
+	assert.NotNil(missing.Start(view))
+	assert.True(missing.Disqualified())
+	assert.Equal(types.Direction(types.Forfeit), missing.Decide(view))
+	assert.Nil(missing.Close())
+
+	// closing while the bot is deciding
+	busy, err := NewExternalBot(program("busy", "", "sleep 1"), 200*time.Millisecond, false)
+	assert.Nil(err)
+	busy.startup = 0
+	decided := make(chan types.Direction)
+	go func() {
+		decided <- busy.Decide(view)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	busy.Close()
+	assert.Equal(types.Direction(types.Forfeit), <-decided)
+	assert.False(busy.Disqualified())
+}
+
+// forfeitingBot gives up at once, like a disqualified external bot.
+type forfeitingBot struct{}
+
+func (forfeitingBot) Decide(v GameView) types.Direction {
+	return types.Forfeit
+}
+
+func TestNetBotForfeit(t *testing.T) {
+	assert := assert.New(t)
+	players := []playerData{
+		{history: []gui.Position{{X: 0, Y: 0}}, color: "a", dir: types.Right},
+		{history: []gui.Position{{X: 9, Y: 9}}, color: "b", dir: types.Left},
+	}
+	game := newGame(10, 10, players, types.Headless)
+	// sending to the server would fail as the client is not connected
+	h, err := NewNetGameHandler(game, &client.Client{}, "a", WASDKeys, forfeitingBot{}, 2)
+	assert.Nil(err)
+	tick := &types.TickMsg{
+		JsonMsg: &types.JsonMsg{Type: "server_tick"},
+		Changes: []types.GameChange{{Color: "a"}, {Color: "b"}},
+	}
+	assert.Nil(h.processTick(tick))
+	assert.Nil(h.bot)
+	assert.Nil(h.processTick(tick))
+	assert.False(game.state.players[0].isDead)
+}
@@ -1,14 +1,19 @@
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/tron_client/client"
 	"github.com/tron_client/gui"
 	"github.com/tron_client/types"
 	"log"
+	"sync"
 	"time"
 )
 
+// default time elapsed between two steps of a local game
+const defaultTickTime = 450 * time.Millisecond
+
 type GameHandler interface {
 	ListenInput()
 	Close()
@@ -17,36 +22,73 @@ type GameHandler interface {
 type NetGameHandler struct {
 	netw   *client.Client
 	engine *Game
+	// color of the player controlled by this client
+	color types.PlayerColor
+	keys  KeyBinding
+	queue *inputQueue
+	// bot plays instead of the user if set, it is owned by the caller
+	bot Bot
 
 	stopNet chan bool
+	// finished is closed after the last tick of the game
+	finished chan bool
 }
 
-func NewNetGameHandler(e *Game, n *client.Client) *NetGameHandler {
-	return &NetGameHandler{
-		netw:    n,
-		engine:  e,
-		stopNet: make(chan bool),
+func NewNetGameHandler(e *Game, n *client.Client, color types.PlayerColor,
+	keys KeyBinding, bot Bot, maxTurns int) (*NetGameHandler, error) {
+	p, err := e.playerByColor(color)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown color of own player: %s", color)
+	}
+	e.gameGui.Follow(color)
+	if bot != nil {
+		startBot(bot, newGameView(e.state, color))
 	}
+	return &NetGameHandler{
+		netw:     n,
+		engine:   e,
+		color:    color,
+		keys:     keys,
+		bot:      bot,
+		queue:    newInputQueue(p.dir, maxTurns),
+		stopNet:  make(chan bool, 1),
+		finished: make(chan bool),
+	}, nil
 }
 
+// ListenInput returns after the last tick of the game, when the messages of
+// the server are left to the caller again.
 func (h *NetGameHandler) ListenInput() {
 	go func(stop chan bool) {
+		defer close(h.finished)
 		for {
 			select {
 			case <-stop:
 				log.Printf("Game phase: Listening to server stopped")
 				return
-			case m := <-h.netw.Msgs:
+			case m, ok := <-h.netw.Msgs:
+				if !ok {
+					log.Printf("Game phase: connection to server lost")
+					return
+				}
 				switch m.GetType() {
 				case "server_tick":
-					h.processTick(m.(*types.TickMsg))
+					t := m.(*types.TickMsg)
+					if err := h.processTick(t); err != nil {
+						log.Printf("Game phase: %s", err.Error())
+					}
+					if t.LastTick {
+						log.Printf("Game phase: last tick received")
+						return
+					}
 				case "error":
 					log.Fatalf("Handling error message is not implemented") // TODO
 				}
 			}
 		}
 	}(h.stopNet)
-	h.listenUserInput()
+	go h.listenUserInput()
+	<-h.finished
 }
 
 func (h *NetGameHandler) Close() {
@@ -56,26 +98,21 @@ func (h *NetGameHandler) Close() {
 func (h *NetGameHandler) processTick(t *types.TickMsg) error {
 	// assert last tick is correct
 	if t.LastTick {
-		player_alive_count := 0
-		for i := range h.engine.players {
-			if !h.engine.players[i].isDead {
-				player_alive_count++
-			}
-		}
-		if player_alive_count > 1 {
-			return fmt.Errorf("Last tick happened with %d number of players alive",
-				player_alive_count)
+		side_alive_count := countSides(h.engine.state.alivePlayers())
+		if side_alive_count > 1 {
+			return fmt.Errorf("Last tick happened with %d number of teams alive",
+				side_alive_count)
 		}
 	}
-	// apply changes
+	// collect changes
+	in := make(inputs)
 	for _, change := range t.Changes {
 		p, err := h.engine.playerByColor(change.Color)
 		if err != nil {
 			return err
 		}
-		// TODO verify it is not opposite direction
-		if change.Dir != "" {
-			p.dir = change.Dir
+		if change.Dir != "" || change.Boost {
+			in[p.color] = input{dir: change.Dir, boost: change.Boost}
 		}
 		if p.isDead != change.Dead {
 			return fmt.Errorf("Player with color %s is Dead: %t, but server's opinion is: %t",
@@ -84,16 +121,85 @@ func (h *NetGameHandler) processTick(t *types.TickMsg) error {
 	}
 
 	// time elapsed, make a step
-	h.engine.Step()
-	return nil
+	h.engine.Step(in)
+
+	// the server decides about the items
+	if t.Items != nil {
+		items := h.engine.state.items
+		if err := h.engine.state.setItems(t.Items); err != nil {
+			return err
+		}
+		h.engine.gameGui.BeginFrame()
+		h.engine.drawItems(items, h.engine.state.items)
+		h.engine.gameGui.EndFrame()
+	}
+	for _, change := range t.Changes {
+		p, _ := h.engine.playerByColor(change.Color)
+		if change.PowerUp != "" && string(p.powerUp) != change.PowerUp {
+			log.Printf("Player with color %s has power-up '%s', but server's opinion is: '%s'",
+				p.color, p.powerUp, change.PowerUp)
+		}
+	}
+
+	// the server decides about the direction, queued turns are sent one per
+	// tick
+	p, err := h.engine.playerByColor(h.color)
+	if err != nil {
+		return err
+	}
+	h.queue.sync(p.dir)
+	if h.bot != nil && !p.isDead {
+		d := h.bot.Decide(newGameView(h.engine.state, h.color))
+		if d == types.Forfeit {
+			// forfeit is not a direction of the protocol, the player goes
+			// on without the bot
+			log.Printf("Game phase: bot forfeits, it stops playing")
+			h.bot = nil
+		} else if d != p.dir {
+			h.queue.push(d)
+		}
+	}
+	d, turn := h.queue.pop()
+	boost := h.queue.popBoost()
+	if !turn && !boost {
+		return nil
+	}
+	if !turn {
+		d = p.dir
+	}
+	return h.sendEvent(d, boost)
+}
+
+func (h *NetGameHandler) sendEvent(d types.Direction, boost bool) error {
+	msg := &types.PlayerEventMsg{
+		JsonMsg: &types.JsonMsg{Type: "player_event"},
+		Color:   h.color,
+		Dir:     d,
+	}
+	if boost {
+		msg.Action = "boost"
+	}
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return h.netw.SendMessage(bytes)
 }
 
 func (h *NetGameHandler) listenUserInput() {
 	log.Printf("Game phase: listening user input")
 	for {
 		key := h.engine.gameGui.UserInput()
-		// TODO send player event on appropiate key pressed
-		switch key {
+		select {
+		case <-h.finished:
+			log.Printf("Game phase: stop receiving user input")
+			return
+		default:
+		}
+		if h.keys.isAction(key) {
+			h.queue.pushBoost()
+		} else if dir, ok := h.keys.Dirs[key]; ok {
+			h.queue.push(dir)
 		}
 	}
 }
@@ -102,82 +208,282 @@ func (h *NetGameHandler) listenUserInput() {
 // Local Game Handler
 
 type LocalGameHandler struct {
-	engine       *Game
-	playerQueues [2]chan types.Direction
+	engine *Game
+	// the order of playerQueues, bindings and bots is the same as the order
+	// of players in the engine. Seats played by bots have no key binding,
+	// seats of humans have no bot.
+	playerQueues []*inputQueue
+	bindings     []KeyBinding
+	bots         []Bot
 
-	stopped bool
+	// stop is closed by Close, which waits for the ticking goroutine to
+	// return before the bots and the window can be closed
+	stop      chan bool
+	closeOnce sync.Once
+	ticking   sync.WaitGroup
 }
 
-func NewLocalGameHandler(engine *Game) *LocalGameHandler {
-	return &LocalGameHandler{
-		engine: engine,
-		playerQueues: [...]chan types.Direction{
-			make(chan types.Direction, 10),
-			make(chan types.Direction, 10)},
+// NewLocalGameHandler assigns the key bindings to the seats not taken by
+// bots in seat order.
+func NewLocalGameHandler(engine *Game, bindings []KeyBinding, bots []Bot,
+	maxTurns int) (*LocalGameHandler, error) {
+	players := engine.state.players
+	if len(players) < minLocalPlayers || len(players) > maxLocalPlayers {
+		return nil, fmt.Errorf("Number of local players should be between %d and %d",
+			minLocalPlayers, maxLocalPlayers)
+	}
+	l := &LocalGameHandler{
+		engine:       engine,
+		playerQueues: make([]*inputQueue, len(players)),
+		bindings:     make([]KeyBinding, len(players)),
+		bots:         make([]Bot, len(players)),
+		stop:         make(chan bool),
 	}
+	copy(l.bots, bots)
+	humans := 0
+	for i := range players {
+		l.playerQueues[i] = newInputQueue(players[i].dir, maxTurns)
+		if l.bots[i] == nil {
+			if humans < len(bindings) {
+				l.bindings[i] = bindings[humans]
+			}
+			if humans == 0 {
+				engine.gameGui.Follow(players[i].color)
+			}
+			humans++
+		}
+	}
+	if err := validateKeyBindings(bindings, humans); err != nil {
+		return nil, err
+	}
+	return l, nil
 }
 
 func (l *LocalGameHandler) ListenInput() {
 	// start ticking
-	go l.ticking()
+	l.ticking.Add(1)
+	go l.tick()
 
 	log.Printf("Game phase: listening user input")
 	for {
 		key := l.engine.gameGui.UserInput()
-		switch key {
-		case gui.Key_a:
-			l.playerQueues[1] <- types.Left
-		case gui.Key_w:
-			l.playerQueues[1] <- types.Up
-		case gui.Key_s:
-			l.playerQueues[1] <- types.Down
-		case gui.Key_d:
-			l.playerQueues[1] <- types.Right
-
-		case gui.Left:
-			l.playerQueues[0] <- types.Left
-		case gui.Up:
-			l.playerQueues[0] <- types.Up
-		case gui.Down:
-			l.playerQueues[0] <- types.Down
-		case gui.Right:
-			l.playerQueues[0] <- types.Right
-		}
-		if l.stopped {
+		if key == gui.Key_q {
+			// the game is closed by its owner after Wait returns
+			log.Printf("Local game: quit by user")
+			return
+		}
+		for i, b := range l.bindings {
+			if b.isAction(key) {
+				l.playerQueues[i].pushBoost()
+				break
+			} else if dir, ok := b.Dirs[key]; ok {
+				l.playerQueues[i].push(dir)
+				break
+			}
+		}
+		select {
+		case <-l.stop:
 			log.Printf("Local game: stop receiving user input")
+			return
+		default:
 		}
 	}
 }
 
+// Close stops ticking and the bots. No tick is drawn after it returns, so the
+// window can be closed. It may be called more than once.
 func (l *LocalGameHandler) Close() {
-	l.stopped = true
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		l.ticking.Wait()
+		closeBots(l.bots)
+	})
 }
 
-func (l *LocalGameHandler) ticking() {
+func (l *LocalGameHandler) tick() {
+	defer l.ticking.Done()
+	for i, b := range l.bots {
+		if b != nil {
+			startBot(b, newGameView(l.engine.state, l.engine.state.players[i].color))
+		}
+	}
+	interval := l.engine.state.tickInterval()
+	ticker := l.engine.newTicker(interval)
+	defer ticker.Stop()
 	for {
-		// sleep will ensure ticking time
-		time.Sleep(450 * time.Millisecond)
-
+		select {
+		case <-l.stop:
+			log.Printf("Local game: stop ticking")
+			return
+		case <-ticker.C():
+		}
 		// get one direction from each player
-		// the order of playerQueues is the same as the order of players in the
-		// engine
+		in := make(inputs)
 		for i, queue := range l.playerQueues {
-			select {
-			case dirChange := <-queue:
-				// check if it is a valid direction
-				// TODO pull a new element if not?
-				if dirChange.Opposite() == l.engine.players[i].dir {
-					break
-				}
-				l.engine.players[i].dir = dirChange
-			default:
-				// queue is empty, nothing to do here.
+			p := l.engine.state.players[i]
+			if l.bots[i] != nil && !p.isDead {
+				in[p.color] = input{dir: l.bots[i].Decide(newGameView(l.engine.state, p.color))}
+				continue
+			}
+			dir, _ := queue.pop()
+			if boost := queue.popBoost(); dir != "" || boost {
+				in[p.color] = input{dir: dir, boost: boost}
 			}
 		}
-		l.engine.Step()
-		if l.stopped {
-			log.Printf("Local game: stop ticking")
+		l.engine.Step(in)
+		// the game speeds up, or slows down again in the next round
+		if next := l.engine.state.tickInterval(); next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
+	}
+}
+
+//----------------------------------------
+// Replay Game Handler
+
+// playback speeds relative to the normal tick time
+var replaySpeeds = [...]float64{0.25, 0.5, 1, 2, 4, 8}
+
+const (
+	normalReplaySpeed = 2  // index of 1x in replaySpeeds
+	replaySeekStep    = 10 // number of ticks to jump when seeking
+)
+
+type replayCommand int
+
+const (
+	replayTogglePause replayCommand = iota
+	replayStep
+	replayFaster
+	replaySlower
+	replaySeekBack
+	replaySeekForward
+	replayRestart
+)
+
+type ReplayGameHandler struct {
+	engine *Game
+	replay *Replay
+
+	// commands are executed by the playback goroutine, which is the only one
+	// touching the game
+	commands chan replayCommand
+	stop     chan bool
+}
+
+func NewReplayGameHandler(engine *Game, r *Replay) *ReplayGameHandler {
+	return &ReplayGameHandler{
+		engine:   engine,
+		replay:   r,
+		commands: make(chan replayCommand, 10),
+		stop:     make(chan bool, 1),
+	}
+}
+
+func (r *ReplayGameHandler) ListenInput() {
+	go r.playback()
+
+	log.Printf("Replay: listening user input")
+	for {
+		key := r.engine.gameGui.UserInput()
+		switch key {
+		case gui.Key_space:
+			r.commands <- replayTogglePause
+		case gui.Key_n:
+			r.commands <- replayStep
+		case gui.Key_plus:
+			r.commands <- replayFaster
+		case gui.Key_minus:
+			r.commands <- replaySlower
+		case gui.Key_lbracket:
+			r.commands <- replaySeekBack
+		case gui.Key_rbracket:
+			r.commands <- replaySeekForward
+		case gui.Key_r:
+			r.commands <- replayRestart
+		case gui.Key_q:
+			log.Printf("Replay: stop receiving user input")
+			return
+		}
+	}
+}
+
+func (r *ReplayGameHandler) Close() {
+	r.stop <- true
+}
+
+func (r *ReplayGameHandler) playback() {
+	paused := false
+	speed := normalReplaySpeed
+	interval := r.interval(speed)
+	ticker := r.engine.newTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			log.Printf("Replay: playback stopped")
 			return
+		case <-ticker.C():
+			if !paused {
+				r.step()
+			}
+			if next := r.interval(speed); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		case cmd := <-r.commands:
+			switch cmd {
+			case replayTogglePause:
+				paused = !paused
+			case replayStep:
+				// stepping only makes sense while paused
+				paused = true
+				r.step()
+			case replayFaster:
+				if speed < len(replaySpeeds)-1 {
+					speed++
+					interval = r.interval(speed)
+					ticker.Reset(interval)
+				}
+			case replaySlower:
+				if speed > 0 {
+					speed--
+					interval = r.interval(speed)
+					ticker.Reset(interval)
+				}
+			case replaySeekBack:
+				r.Seek(r.engine.state.tick - replaySeekStep)
+			case replaySeekForward:
+				r.Seek(r.engine.state.tick + replaySeekStep)
+			case replayRestart:
+				r.Seek(0)
+			}
 		}
 	}
 }
+
+// Seek rebuilds the board as it was at the given tick.
+func (r *ReplayGameHandler) Seek(tick int) {
+	if tick < 0 {
+		tick = 0
+	}
+	if tick > len(r.replay.Ticks) {
+		tick = len(r.replay.Ticks)
+	}
+	r.engine.seek(tick, r.replay)
+}
+
+func (r *ReplayGameHandler) step() {
+	if r.engine.state.tick >= len(r.replay.Ticks) {
+		return // end of recording
+	}
+	r.engine.Step(r.replay.inputs(r.engine.state.tick))
+}
+
+// interval is the time between two ticks of the recorded game at the given
+// playback speed.
+func (r *ReplayGameHandler) interval(speed int) time.Duration {
+	return time.Duration(float64(r.engine.state.tickInterval()) / replaySpeeds[speed])
+}
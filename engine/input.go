@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"github.com/tron_client/types"
+	"sync"
+)
+
+// number of turns a player can queue up ahead of the ticks by default
+const defaultMaxTurns = 3
+
+// inputQueue buffers the turns of a single player until the next ticks. A
+// turn is validated against the direction that will be in effect when the
+// turn is applied, so quick double turns (e.g. up then left) are kept.
+type inputQueue struct {
+	turns []types.Direction
+	max   int
+	// direction in effect after every queued turn is applied
+	last types.Direction
+	// boost is set if the player asked for a boost since the last tick
+	boost bool
+
+	lock sync.Mutex
+}
+
+func newInputQueue(dir types.Direction, max int) *inputQueue {
+	return &inputQueue{
+		turns: make([]types.Direction, 0, max),
+		max:   max,
+		last:  dir,
+	}
+}
+
+// push queues a turn. It returns false if the turn is dropped, because the
+// queue is full or the turn makes no sense after the queued ones.
+func (q *inputQueue) push(d types.Direction) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.turns) >= q.max {
+		return false
+	}
+	if d == q.last || d == q.last.Opposite() {
+		return false
+	}
+	q.turns = append(q.turns, d)
+	q.last = d
+	return true
+}
+
+// pop returns the turn to apply at the next tick, if there is any.
+func (q *inputQueue) pop() (types.Direction, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.turns) == 0 {
+		return "", false
+	}
+	d := q.turns[0]
+	q.turns = q.turns[1:]
+	return d, true
+}
+
+// pushBoost asks for a boost in the next tick.
+func (q *inputQueue) pushBoost() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.boost = true
+}
+
+// popBoost tells if a boost was asked for since the last call.
+func (q *inputQueue) popBoost() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	boost := q.boost
+	q.boost = false
+	return boost
+}
+
+// sync sets the direction of the player if there are no turns queued, in
+// case the direction was changed by someone else, e.g. the server.
+func (q *inputQueue) sync(dir types.Direction) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.turns) == 0 {
+		q.last = dir
+	}
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+)
+
+const (
+	minLocalPlayers = 2
+	maxLocalPlayers = 4
+)
+
+// KeyBinding maps the keys of a local player to directions, and optionally
+// binds an action key to boosting.
+type KeyBinding struct {
+	Dirs map[gui.PlayerKey]types.Direction
+	// Action is the key of boosting, 0 if the player has none
+	Action gui.PlayerKey
+}
+
+// isAction tells if the key is the action key of the binding.
+func (b KeyBinding) isAction(key gui.PlayerKey) bool {
+	return b.Action != 0 && key == b.Action
+}
+
+// keys lists every key of the binding.
+func (b KeyBinding) keys() []gui.PlayerKey {
+	keys := make([]gui.PlayerKey, 0, len(b.Dirs)+1)
+	for key := range b.Dirs {
+		keys = append(keys, key)
+	}
+	if b.Action != 0 {
+		keys = append(keys, b.Action)
+	}
+	return keys
+}
+
+var (
+	ArrowKeys = KeyBinding{
+		Dirs: map[gui.PlayerKey]types.Direction{
+			gui.Up:    types.Up,
+			gui.Left:  types.Left,
+			gui.Down:  types.Down,
+			gui.Right: types.Right,
+		},
+		Action: gui.Key_enter,
+	}
+	WASDKeys   = mustParseKeyBinding("wasde")
+	IJKLKeys   = mustParseKeyBinding("ijklo")
+	NumpadKeys = mustParseKeyBinding("84560")
+)
+
+// DefaultKeyBindings are the key bindings of the local players in seat order.
+var DefaultKeyBindings = []KeyBinding{ArrowKeys, WASDKeys, IJKLKeys, NumpadKeys}
+
+// ParseKeyBinding reads a key binding from the keys of up, left, down, right
+// and optionally boost in this order, e.g. "wasd" or "ijklo". "arrows" stands
+// for the arrow keys with enter for boost.
+func ParseKeyBinding(s string) (KeyBinding, error) {
+	if s == "arrows" {
+		return ArrowKeys, nil
+	}
+	keys := []rune(s)
+	if len(keys) != 4 && len(keys) != 5 {
+		return KeyBinding{}, fmt.Errorf("Key binding should have 4 or 5 keys: up, left, down, right, [boost]")
+	}
+	for i := range keys {
+		for _, other := range keys[:i] {
+			if keys[i] == other {
+				return KeyBinding{}, fmt.Errorf("Key '%c' is used twice in key binding", keys[i])
+			}
+		}
+	}
+	b := KeyBinding{Dirs: make(map[gui.PlayerKey]types.Direction)}
+	for i, dir := range []types.Direction{types.Up, types.Left, types.Down, types.Right} {
+		b.Dirs[gui.PlayerKey(keys[i])] = dir
+	}
+	if len(keys) == 5 {
+		b.Action = gui.PlayerKey(keys[4])
+	}
+	return b, nil
+}
+
+func mustParseKeyBinding(s string) KeyBinding {
+	b, err := ParseKeyBinding(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// validateKeyBindings checks that each of the human players has a complete
+// key binding and no key is shared between players.
+func validateKeyBindings(bindings []KeyBinding, players int) error {
+	if len(bindings) < players {
+		return fmt.Errorf("Not enough key bindings for %d players", players)
+	}
+	owners := make(map[gui.PlayerKey]int)
+	for i, b := range bindings[:players] {
+		for _, key := range b.keys() {
+			if key == gui.Key_q {
+				return fmt.Errorf("Key 'q' is reserved for quitting the game")
+			}
+			if owner, ok := owners[key]; ok {
+				return fmt.Errorf("Player %d and %d share the same key", owner+1, i+1)
+			}
+			owners[key] = i
+		}
+		dirs := make(map[types.Direction]bool)
+		for _, dir := range b.Dirs {
+			if isDirection(dir) {
+				dirs[dir] = true
+			}
+		}
+		if len(dirs) != 4 {
+			return fmt.Errorf("Key binding of player %d does not cover every direction", i+1)
+		}
+	}
+	return nil
+}
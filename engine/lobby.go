@@ -10,10 +10,22 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const sys_n string = "Sys"
 
+// seats of a room if the server does not tell
+const defaultRoomSeats = 4
+
+// states of the connection to the server
+const (
+	stateOffline   = "offline"
+	stateConnected = "connected"
+	stateLost      = "connection lost"
+)
+
 type command struct {
 	description string
 	arguments   []string
@@ -22,17 +34,56 @@ type command struct {
 
 type commandMap map[string]command
 
-var commands commandMap = commandMap{
-	"/connect":    {"Connect to server. Default: localhost:8765", []string{"[address]", "[port]"}, executeConnect},
-	"/con":        {"", []string{}, executeConnect},
-	"/disc":       {"", []string{}, executeDisconnect},
-	"/disconnect": {"Disconnect from server", []string{}, executeDisconnect},
-	"/players":    {"List players", []string{}, executePlayers},
-	"/setname":    {"Set your name, or print if no argument", []string{"[NAME]"}, executeSetname},
-	"/ready":      {"Send ready signal", []string{"[false]"}, executeReady},
-	// handled elsewhere
-	"/help": {"Show help", []string{}, func(*LobbyEngine, ...string) {}},
-	"/exit": {"Close application", []string{}, func(*LobbyEngine, ...string) {}},
+var commands commandMap
+
+// commands is filled in init, the commands refer back to it through the
+// completion of the input
+func init() {
+	commands = commandMap{
+		"/connect":    {"Connect to server. Default: localhost:8765", []string{"[address]", "[port]"}, executeConnect},
+		"/con":        {"", []string{}, executeConnect},
+		"/disc":       {"", []string{}, executeDisconnect},
+		"/disconnect": {"Disconnect from server", []string{}, executeDisconnect},
+		"/players":    {"List players", []string{}, executePlayers},
+		"/setname":    {"Set your name, or print if no argument", []string{"[NAME]"}, executeSetname},
+		"/ready":      {"Send ready signal", []string{"[false]"}, executeReady},
+		"/team":       {"Join a team, 0 to play alone", []string{"N"}, executeTeam},
+		"/addbot":     {"Fill an empty seat of the server with a bot", []string{"STRATEGY", "[DIFFICULTY]"}, executeAddbot},
+		"/local":      {"Set up a game on this computer", []string{}, executeLocal},
+		"/search":     {"Highlight messages containing the text, clear without text", []string{"[TEXT]"}, executeSearch},
+		"/timestamps": {"Show the time of the messages", []string{"[off]"}, executeTimestamps},
+		// handled elsewhere
+		"/help": {"Show help", []string{}, func(*LobbyEngine, ...string) {}},
+		"/exit": {"Close application", []string{}, func(*LobbyEngine, ...string) {}},
+	}
+}
+
+func executeTimestamps(c *LobbyEngine, args ...string) {
+	c.timestamps = true
+	if len(args) > 0 {
+		if strings.ToLower(args[0]) != "off" {
+			c.PushError("Unexpected argument for /timestamps")
+			return
+		}
+		c.timestamps = false
+	}
+	c.chatGui.ShowTimestamps(c.timestamps)
+	c.chatGui.SetChatHistory(c.msg_history)
+}
+
+func executeSearch(c *LobbyEngine, args ...string) {
+	text := strings.Join(args, " ")
+	c.chatGui.Search(text)
+	if text == "" {
+		return
+	}
+	found := 0
+	for _, e := range c.msg_history {
+		if strings.Contains(strings.ToLower(e.String()), strings.ToLower(text)) {
+			found++
+		}
+	}
+	c.PushMessage(sys_n, "%d messages contain '%s'", found, text)
 }
 
 func executeReady(c *LobbyEngine, args ...string) {
@@ -41,7 +92,8 @@ func executeReady(c *LobbyEngine, args ...string) {
 		return
 	}
 	readyMsg := &types.ReadyMsg{
-		Value: true,
+		JsonMsg: &types.JsonMsg{Type: "ready"},
+		Value:   true,
 	}
 	if len(args) > 0 {
 		if strings.ToLower(args[0]) != "false" {
@@ -58,6 +110,104 @@ func executeReady(c *LobbyEngine, args ...string) {
 	c.net.SendMessage(bytes)
 }
 
+func executeTeam(c *LobbyEngine, args ...string) {
+	if c.net == nil {
+		c.PushMessage(sys_n, "You are not connected")
+		return
+	}
+	if len(args) != 1 {
+		c.PushMessage(sys_n, "Usage: /team N")
+		return
+	}
+	team, err := strconv.Atoi(args[0])
+	if err != nil || team < 0 || team > maxTeams {
+		c.PushMessage(sys_n, "Team should be between 0 and %d", maxTeams)
+		return
+	}
+	// the server tells the new team to everyone
+	bytes, err := json.Marshal(&types.TeamMsg{
+		JsonMsg: &types.JsonMsg{Type: "team"},
+		Team:    team,
+	})
+	if err != nil {
+		log.Fatalf("Failed to marshal team message")
+	}
+	c.net.SendMessage(bytes)
+}
+
+// executeAddbot joins the room of the user with a bot on a connection of its
+// own if there is a free seat. The bots leave when the user disconnects.
+func executeAddbot(c *LobbyEngine, args ...string) {
+	if c.net == nil {
+		c.PushMessage(sys_n, "You are not connected")
+		return
+	}
+	if len(args) < 1 || len(args) > 2 {
+		c.PushMessage(sys_n, "Usage: /addbot STRATEGY [DIFFICULTY]")
+		return
+	}
+	d := Normal
+	if len(args) > 1 {
+		var err error
+		if d, err = ParseDifficulty(args[1]); err != nil {
+			c.PushError(err.Error())
+			return
+		}
+	}
+	if c.freeSeats() < 1 {
+		c.PushMessage(sys_n, "The room is full, there is no seat for a bot")
+		return
+	}
+	bot, err := NewBot(args[0], d, time.Now().UnixNano())
+	if err != nil {
+		c.PushError(err.Error())
+		return
+	}
+	c.botCount++
+	name := fmt.Sprintf("Bot%d", c.botCount)
+	c.setJoining(name, true)
+	go func(address string, port int, room string, stop chan bool) {
+		err := RunNetBot(address, port, room, name, bot, stop)
+		// the seat is free again if the bot could not join
+		c.setJoining(name, false)
+		log.Printf("Bot %s: %s", name, err.Error())
+	}(c.address, c.port, c.room, c.stopBots)
+	c.PushMessage(sys_n, "%s is joining the room", name)
+}
+
+// freeSeats returns the number of seats of the room not taken by players or
+// by bots joining.
+func (c *LobbyEngine) freeSeats() int {
+	c.botLock.Lock()
+	defer c.botLock.Unlock()
+	return c.seats - 1 - len(c.players) - len(c.joining)
+}
+
+// setJoining marks the bot added with /addbot as joining, or as not joining
+// any more. It returns true if the bot was joining.
+func (c *LobbyEngine) setJoining(name string, joining bool) bool {
+	c.botLock.Lock()
+	defer c.botLock.Unlock()
+	was := c.joining[name]
+	if joining {
+		c.joining[name] = true
+	} else {
+		delete(c.joining, name)
+	}
+	return was
+}
+
+// removeBots disconnects the bots added with /addbot.
+func (c *LobbyEngine) removeBots() {
+	if c.stopBots != nil {
+		close(c.stopBots)
+		c.stopBots = nil
+	}
+	c.botLock.Lock()
+	defer c.botLock.Unlock()
+	c.joining = make(map[string]bool)
+}
+
 func executeSetname(c *LobbyEngine, args ...string) {
 	if len(args) < 1 {
 		c.PushMessage(sys_n, "Your name is: %s", c.myPlayer.Name)
@@ -69,6 +219,7 @@ func executeSetname(c *LobbyEngine, args ...string) {
 		return
 	}
 	c.myPlayer.Name = *name
+	c.updatePlayers()
 	c.PushMessage(sys_n, "Name has been set to: '%s'", *name)
 }
 
@@ -78,11 +229,11 @@ func executePlayers(c *LobbyEngine, _ ...string) {
 	}
 
 	// list players including this client
-	c.PushMessage(sys_n, "Player: %s, Color: %s, Ready: %t",
-		c.myPlayer.Name, c.myPlayer.Color, c.myPlayer.Ready)
+	c.PushMessage(sys_n, "Player: %s, Color: %s, Ready: %t, Team: %d",
+		c.myPlayer.Name, c.myPlayer.Color, c.myPlayer.Ready, c.myPlayer.Team)
 	for i := range c.players {
-		c.PushMessage(sys_n, "Player: %s, Color: %s, Ready: %t", c.players[i].Name,
-			c.players[i].Color, c.players[i].Ready)
+		c.PushMessage(sys_n, "Player: %s, Color: %s, Ready: %t, Team: %d", c.players[i].Name,
+			c.players[i].Color, c.players[i].Ready, c.players[i].Team)
 	}
 }
 
@@ -91,18 +242,24 @@ func executeDisconnect(c *LobbyEngine, _ ...string) {
 		c.PushMessage(sys_n, "You are not connected")
 		return
 	}
-	c.stopRec <- true
+	c.disconnect()
+}
+
+// disconnect stops the listener of the connection, if it is still running,
+// and closes the connection.
+func (c *LobbyEngine) disconnect() {
+	close(c.stopRec)
 	c.net.Close()
 	c.net = nil
+	c.removeBots()
+	c.setConnState(stateOffline, "", "")
 }
 
 func (c *LobbyEngine) Close() {
 	// close network connection
 	if c.net != nil {
 		log.Printf("Closing connection")
-		c.stopRec <- true
-		c.net.Close()
-		c.net = nil
+		c.disconnect()
 	}
 	// close GUI
 	log.Printf("Closing GUI")
@@ -112,31 +269,43 @@ func (c *LobbyEngine) Close() {
 func executeConnect(c *LobbyEngine, args ...string) {
 	if c.net != nil {
 		c.PushMessage(sys_n, "You are already connected. Try to disconnect first with: '/disc[onnect]")
+		return
 	}
 	address, port := "localhost", 8765
 	if len(args) > 0 {
-		address = args[1]
+		address = args[0]
 	}
 	if len(args) > 1 {
 		port_candid, err := strconv.Atoi(args[1])
 		if err != nil {
-			c.PushMessage(sys_n, "Port is not a valid number.")
+			c.PushError("Port is not a valid number.")
 			return
 		}
 		port = port_candid
 	}
 	cli, err := client.Connect(address, port)
 	if err != nil {
-		c.PushMessage(sys_n, "Could not connect to server")
+		c.PushError("Could not connect to server")
 		return
 	}
-	c.net = cli
-	resp, err := c.net.ConnectRequest(c.myPlayer.Name, "", "private")
+	resp, err := cli.ConnectRequest(c.myPlayer.Name, "", "private")
 	if err != nil {
-		c.PushMessage(sys_n, "Server error: %s", err.Error())
+		c.PushError("Server error: %s", err.Error())
+		cli.Close()
+		return
+	}
+	c.net = cli
+	// every connection has its own stop channel, the listener may be gone
+	// when the connection is closed
+	c.stopRec = make(chan bool)
+	c.address, c.port, c.stopBots = address, port, make(chan bool)
+	c.seats = resp.Seats
+	if c.seats == 0 {
+		c.seats = defaultRoomSeats
 	}
 	c.players = resp.Players
 	c.myPlayer.Color = resp.Color
+	c.setConnState(stateConnected, fmt.Sprintf("%s:%d", address, port), resp.Id)
 
 	// start listening to lobby messages
 	go cli.Listen()
@@ -149,44 +318,13 @@ func executeConnect(c *LobbyEngine, args ...string) {
 			case <-stop:
 				log.Printf("Listening to server stopped")
 				return
-			case m := <-cli.Msgs:
-				log.Printf("Message received: %s", m)
-				switch m.GetType() {
-				case "chat":
-					chatMsg := m.(*types.ChatMsg)
-					p, err := c.playerByColor(chatMsg.Color)
-					if err != nil {
-						c.PushMessage(sys_n, "Server error")
-					}
-					c.PushMessage(p.Name, chatMsg.Message)
-				case "ready":
-					r := m.(*types.ReadyMsg)
-					p, err := c.playerByColor(r.Color)
-					if err != nil {
-						c.PushMessage(sys_n, "Server error")
-					}
-					// assign new ready value
-					p.Ready = r.Value
-					c.PushMessage(sys_n, "%s set ready to %t", p.Name, r.Value)
-				case "connection":
-					ack := m.(*types.ConnAckMsg)
-					switch ack.Action {
-					case "disconnect":
-						c.PushMessage(sys_n, "Player %s (%s) disconnected", ack.Player.Name, ack.Player.Color)
-						err = c.removeByColor(ack.Player.Color)
-						if err != nil {
-							c.PushMessage(sys_n, "Error: player unknown")
-						}
-					case "connec":
-						c.PushMessage(sys_n, "Player %s (%s) connected", ack.Player.Name, ack.Player.Color)
-						// add to players list
-						c.players = append(c.players, ack.Player)
-					default:
-						c.PushMessage(sys_n, "Error: malformed message")
-					}
-				case "start_game":
-					// advance to game phase
-					c.Close()
+			case m, ok := <-cli.Msgs:
+				if !ok {
+					log.Printf("Connection to server lost")
+					c.setConnState(stateLost, c.server, c.room)
+					return
+				}
+				if !c.handleMessage(m) {
 					return
 				}
 			}
@@ -197,48 +335,227 @@ func executeConnect(c *LobbyEngine, args ...string) {
 	c.PushMessage(sys_n, "Successfully connected")
 }
 
+// handleMessage updates the lobby with a message of the server. It returns
+// false if the lobby stops listening to the server because the game starts.
+func (c *LobbyEngine) handleMessage(m types.JsonMsgI) bool {
+	log.Printf("Message received: %s", m)
+	switch m.GetType() {
+	case "chat":
+		chatMsg := m.(*types.ChatMsg)
+		p, err := c.playerByColor(chatMsg.Color)
+		if err != nil {
+			c.PushError("Server error")
+			break
+		}
+		c.PushChat(*p, chatMsg.Message)
+	case "ready":
+		r := m.(*types.ReadyMsg)
+		p, err := c.playerByColor(r.Color)
+		if err != nil {
+			c.PushError("Server error")
+			break
+		}
+		// assign new ready value
+		p.Ready = r.Value
+		c.updatePlayers()
+		c.PushMessage(sys_n, "%s set ready to %t", p.Name, r.Value)
+	case "team":
+		t := m.(*types.TeamMsg)
+		p, err := c.playerByColor(t.Color)
+		if err != nil {
+			c.PushError("Server error")
+			break
+		}
+		p.Team = t.Team
+		c.updatePlayers()
+		if t.Team == 0 {
+			c.PushMessage(sys_n, "%s plays alone", p.Name)
+		} else {
+			c.PushMessage(sys_n, "%s joined team %d", p.Name, t.Team)
+		}
+	case "connection":
+		ack := m.(*types.ConnAckMsg)
+		switch ack.Action {
+		case "disconnect":
+			c.PushMessage(sys_n, "Player %s (%s) disconnected", ack.Player.Name, ack.Player.Color)
+			if err := c.removeByColor(ack.Player.Color); err != nil {
+				c.PushError("Error: player unknown")
+			}
+			c.updatePlayers()
+		case "connec":
+			c.PushMessage(sys_n, "Player %s (%s) connected", ack.Player.Name, ack.Player.Color)
+			// add to players list
+			c.players = append(c.players, ack.Player)
+			c.updatePlayers()
+			if c.setJoining(ack.Player.Name, false) {
+				c.PushMessage(sys_n, "%s took the seat with color %s", ack.Player.Name, ack.Player.Color)
+			}
+		default:
+			c.PushError("Error: malformed message")
+		}
+	case "start_game":
+		// advance to game phase
+		c.Close()
+		return false
+	}
+	return true
+}
+
 type LobbyEngine struct {
 	IsListening chan bool
 
 	players     []types.LobbyPlayer
 	myPlayer    types.LobbyPlayer
-	msg_history []string
+	msg_history []gui.ChatEntry
+	timestamps  bool
+	// state of the connection shown in the status bar
+	connState string
+	server    string
+	room      string
+	// the server joined, bots added with /addbot connect to it too
+	address  string
+	port     int
+	stopBots chan bool
+	botCount int
+	// number of players the room takes, the bots still joining hold a seat
+	seats   int
+	botLock sync.Mutex
+	joining map[string]bool
 
 	chatGui gui.ChatGui
+	guiType types.GuiKind
 
 	net     *client.Client
 	stopRec chan bool
 }
 
 func NewLobbyEngine(guiType types.GuiKind) *LobbyEngine {
-	var g gui.ChatGui
-	switch guiType {
-	case types.NCursesLobby:
-		g = gui.NewNCurse()
-	case types.Headless:
-		g = gui.NewHeadlessChat()
-	}
-
 	c := LobbyEngine{
 		IsListening: make(chan bool, 1),
-		stopRec:     make(chan bool, 1),
-		msg_history: make([]string, 0, 20),
-		chatGui:     g,
+		msg_history: make([]gui.ChatEntry, 0, 20),
+		chatGui:     newChatGui(guiType),
+		guiType:     guiType,
+		connState:   stateOffline,
+		joining:     make(map[string]bool),
 	}
 	c.myPlayer.Name = "Buddy"
+	c.setUpChatGui()
 	c.PushMessage(sys_n, "Hello! Good luck today. type '/help' for available commands")
 	return &c
 }
 
+// setUpChatGui shows the state of the lobby in a new chat GUI.
+func (c *LobbyEngine) setUpChatGui() {
+	c.chatGui.SetCompleter(c.complete)
+	c.chatGui.ShowTimestamps(c.timestamps)
+	c.chatGui.SetChatHistory(c.msg_history)
+	c.updatePlayers()
+	c.updateStatus()
+}
+
+// updatePlayers shows the players of the room, this client first.
+func (c *LobbyEngine) updatePlayers() {
+	if c.net == nil {
+		c.chatGui.SetPlayers(nil)
+		return
+	}
+	c.chatGui.SetPlayers(append([]types.LobbyPlayer{c.myPlayer}, c.players...))
+}
+
+func (c *LobbyEngine) setConnState(state string, server string, room string) {
+	c.connState, c.server, c.room = state, server, room
+	c.updatePlayers()
+	c.updateStatus()
+}
+
+func (c *LobbyEngine) updateStatus() {
+	c.chatGui.SetStatus(gui.LobbyStatus{State: c.connState, Server: c.server, Room: c.room})
+}
+
+func newChatGui(guiType types.GuiKind) gui.ChatGui {
+	switch guiType {
+	case types.NCursesLobby:
+		return gui.NewNCurse()
+	case types.Headless:
+		return gui.NewHeadlessChat()
+	}
+	return nil
+}
+
+// PushMessage adds a system message to the chat history.
 func (c *LobbyEngine) PushMessage(sender string, msg string, args ...interface{}) {
 	if len(msg) < 1 {
 		log.Printf("Attempt tp push empty message.")
 	}
-	msg = fmt.Sprintf(msg, args...)
-	c.msg_history = append(c.msg_history, fmt.Sprintf("%s: %s", sender, msg))
+	c.push(gui.ChatEntry{Sender: sender, Kind: gui.SystemMessage, Text: fmt.Sprintf(msg, args...)})
+}
+
+// PushError adds an error message to the chat history.
+func (c *LobbyEngine) PushError(msg string, args ...interface{}) {
+	c.push(gui.ChatEntry{Sender: sys_n, Kind: gui.ErrorMessage, Text: fmt.Sprintf(msg, args...)})
+}
+
+// PushChat adds a message sent by a player to the chat history.
+func (c *LobbyEngine) PushChat(p types.LobbyPlayer, msg string) {
+	c.push(gui.ChatEntry{Sender: p.Name, Color: p.Color, Kind: gui.ChatMessage, Text: msg})
+}
+
+func (c *LobbyEngine) push(e gui.ChatEntry) {
+	e.Time = time.Now()
+	c.msg_history = append(c.msg_history, e)
 	c.chatGui.SetChatHistory(c.msg_history)
 }
 
+// complete returns the completions of a word of the input: commands, their
+// arguments and names of the players. Mentions start with '@'.
+func (c *LobbyEngine) complete(words []string, prefix string) []string {
+	var candidates []string
+	switch {
+	case len(words) == 0 && strings.HasPrefix(prefix, "/"):
+		for key := range commands {
+			candidates = append(candidates, key)
+		}
+	case len(words) == 1 && strings.HasPrefix(words[0], "/"):
+		candidates = commandArguments(words[0])
+	case strings.HasPrefix(prefix, "@"):
+		for _, p := range c.players {
+			candidates = append(candidates, "@"+p.Name)
+		}
+	default:
+		for _, p := range c.players {
+			candidates = append(candidates, p.Name)
+		}
+	}
+	var found []string
+	for _, cand := range candidates {
+		if strings.HasPrefix(strings.ToLower(cand), strings.ToLower(prefix)) {
+			found = append(found, cand)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// commandArguments returns the values the first argument of the command may
+// take.
+func commandArguments(command string) []string {
+	switch command {
+	case "/ready":
+		return []string{"false"}
+	case "/timestamps":
+		return []string{"off"}
+	case "/team":
+		teams := make([]string, maxTeams+1)
+		for i := range teams {
+			teams[i] = strconv.Itoa(i)
+		}
+		return teams
+	case "/addbot":
+		return BotStrategies
+	}
+	return nil
+}
+
 func (c *LobbyEngine) ListenUserInput() {
 	log.Print("Start fetching messages from chat")
 	for {
@@ -281,11 +598,11 @@ func (c *LobbyEngine) ListenUserInput() {
 			} else if command, ok := commands[words[0]]; ok {
 				command.execute(c, words[1:]...)
 			} else {
-				c.PushMessage(sys_n, "Unkown command: '%s'", words[0])
+				c.PushError("Unkown command: '%s'", words[0])
 			}
 		} else {
 			// simple message
-			c.PushMessage(c.myPlayer.Name, msg)
+			c.PushChat(c.myPlayer, msg)
 			chatMsg := &types.ChatMsg{
 				JsonMsg: &types.JsonMsg{Type: "chat"},
 				Message: msg,
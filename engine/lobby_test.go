@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"github.com/tron_client/client"
 	"github.com/tron_client/gui"
 	"github.com/tron_client/types"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -115,10 +117,12 @@ func TestChatCommunicationWithServer(t *testing.T) {
 	// assert for a new entry in message history
 	assert.Equal(chatHistoryCount+1, len(lobby.msg_history))
 	// history  should contain the message
-	if !strings.Contains(lobby.msg_history[chatHistoryCount],
+	if !strings.Contains(lobby.msg_history[chatHistoryCount].Text,
 		"Hey, what's up? I'm looking forward to play Tron with you") {
 		t.Fatalf("Received message is not in history")
 	}
+	assert.Equal(gui.ChatMessage, lobby.msg_history[chatHistoryCount].Kind)
+	assert.Equal(types.PlayerColor("#0000FF"), lobby.msg_history[chatHistoryCount].Color)
 
 	// let's say Kek sent ready
 	outBytes, err = json.Marshal(&types.ReadyMsg{
@@ -153,3 +157,152 @@ func TestChatCommunicationWithServer(t *testing.T) {
 	assert.Nil(lobby.chatGui)
 
 }
+
+func TestComplete(t *testing.T) {
+	assert := assert.New(t)
+	lobby := NewLobbyEngine(types.Headless)
+	lobby.players = []types.LobbyPlayer{{Name: "Zold"}, {Name: "Kek"}, {Name: "Zizi"}}
+
+	assert.Equal([]string{"/search", "/setname"}, lobby.complete(nil, "/se"))
+	assert.Equal([]string{"false"}, lobby.complete([]string{"/ready"}, ""))
+	assert.Equal([]string{"floodfill"}, lobby.complete([]string{"/addbot"}, "f"))
+	assert.Equal([]string{"@Zizi", "@Zold"}, lobby.complete([]string{"hi"}, "@z"))
+	assert.Equal([]string{"Kek"}, lobby.complete(nil, "k"))
+}
+
+func TestLobbyPlayerListAndStatus(t *testing.T) {
+	assert := assert.New(t)
+	lobby := NewLobbyEngine(types.Headless)
+	headless := lobby.chatGui.(*gui.HeadlessChat)
+	assert.Empty(headless.Players())
+	assert.Equal(gui.LobbyStatus{State: stateOffline}, headless.Status())
+
+	// assume the user connected, the connection is not used
+	lobby.net = &client.Client{}
+	lobby.myPlayer.Color = "#FF0000"
+	lobby.players = []types.LobbyPlayer{{Color: "#00FF00", Name: "Zold"}}
+	lobby.setConnState(stateConnected, "localhost:8765", "room")
+	assert.Equal(gui.LobbyStatus{State: stateConnected, Server: "localhost:8765", Room: "room"}, headless.Status())
+	assert.Equal([]types.LobbyPlayer{{Color: "#FF0000", Name: "Buddy"}, {Color: "#00FF00", Name: "Zold"}},
+		headless.Players())
+
+	// Kek joins and gets ready
+	kek := types.LobbyPlayer{Color: "#0000FF", Name: "Kek"}
+	assert.True(lobby.handleMessage(&types.ConnAckMsg{
+		JsonMsg: &types.JsonMsg{Type: "connection"}, Player: kek, Action: "connec"}))
+	assert.Equal(3, len(headless.Players()))
+	assert.Equal("Kek", headless.Players()[2].Name)
+	assert.False(headless.Players()[2].Ready)
+	ready := &types.ReadyMsg{JsonMsg: &types.JsonMsg{Type: "ready"}, Value: true, Color: "#0000FF"}
+	assert.True(lobby.handleMessage(ready))
+	assert.True(headless.Players()[2].Ready)
+	ready.Value = false
+	assert.True(lobby.handleMessage(ready))
+	assert.False(headless.Players()[2].Ready)
+
+	// Zold leaves
+	assert.True(lobby.handleMessage(&types.ConnAckMsg{
+		JsonMsg: &types.JsonMsg{Type: "connection"}, Player: lobby.players[0], Action: "disconnect"}))
+	assert.Equal(2, len(headless.Players()))
+	assert.Equal("Kek", headless.Players()[1].Name)
+
+	// the status bar tells if the connection is lost
+	lobby.setConnState(stateLost, lobby.server, lobby.room)
+	assert.Equal(gui.LobbyStatus{State: stateLost, Server: "localhost:8765", Room: "room"}, headless.Status())
+	lobby.net = nil
+	lobby.setConnState(stateOffline, "", "")
+	assert.Empty(headless.Players())
+	assert.Equal(gui.LobbyStatus{State: stateOffline}, headless.Status())
+}
+
+func TestAddbotSeats(t *testing.T) {
+	assert := assert.New(t)
+	lobby := NewLobbyEngine(types.Headless)
+	last := func() string { return lobby.msg_history[len(lobby.msg_history)-1].Text }
+
+	// assume the user connected to a room of three, Zold is there and a bot
+	// is joining
+	lobby.net = &client.Client{}
+	lobby.seats = 3
+	lobby.players = []types.LobbyPlayer{{Color: "#00FF00", Name: "Zold"}}
+	lobby.setJoining("Bot1", true)
+	assert.Equal(0, lobby.freeSeats())
+	executeAddbot(lobby, "floodfill")
+	assert.Contains(last(), "The room is full")
+
+	// the bot got its seat, the room is still full
+	assert.True(lobby.handleMessage(&types.ConnAckMsg{JsonMsg: &types.JsonMsg{Type: "connection"},
+		Player: types.LobbyPlayer{Color: "#0000FF", Name: "Bot1"}, Action: "connec"}))
+	assert.Contains(last(), "Bot1 took the seat with color #0000FF")
+	assert.Equal(0, lobby.freeSeats())
+
+	// Zold leaves
+	assert.True(lobby.handleMessage(&types.ConnAckMsg{
+		JsonMsg: &types.JsonMsg{Type: "connection"}, Player: lobby.players[0], Action: "disconnect"}))
+	assert.Equal(1, lobby.freeSeats())
+}
+
+// waitFor polls the condition until it holds or a second passes.
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestReconnectAfterConnectionLost(t *testing.T) {
+	assert := assert.New(t)
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err.Error())
+	}
+	defer l.Close()
+	// the server answers the connection requests
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			con, err := l.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(con).ReadString('\n')
+			bytes, _ := json.Marshal(&types.ConnRespMsg{
+				JsonMsg: &types.JsonMsg{Type: "connect"},
+				Color:   "#FF0000",
+				Id:      "room",
+			})
+			con.Write(append(bytes, '\n'))
+			conns <- con
+		}
+	}()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	lobby := NewLobbyEngine(types.Headless)
+	headless := lobby.chatGui.(*gui.HeadlessChat)
+
+	executeConnect(lobby, "127.0.0.1", port)
+	con := <-conns
+	assert.Equal(stateConnected, headless.Status().State)
+	con.Close()
+	assert.True(waitFor(func() bool { return headless.Status().State == stateLost }))
+
+	executeDisconnect(lobby)
+	assert.Equal(stateOffline, headless.Status().State)
+	executeConnect(lobby, "127.0.0.1", port)
+	con = <-conns
+	defer con.Close()
+
+	// the listener of the new connection is still running when a message
+	// arrives
+	time.Sleep(20 * time.Millisecond)
+	bytes, _ := json.Marshal(&types.ConnAckMsg{
+		JsonMsg: &types.JsonMsg{Type: "connection"},
+		Player:  types.LobbyPlayer{Color: "#00FF00", Name: "Zold"},
+		Action:  "connec",
+	})
+	con.Write(append(bytes, '\n'))
+	assert.True(waitFor(func() bool { return len(headless.Players()) == 2 }))
+	executeDisconnect(lobby)
+}
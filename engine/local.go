@@ -0,0 +1,473 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minArenaSize = 10
+	maxArenaSize = 200
+	minTickTime  = 50 * time.Millisecond
+	maxTickTime  = 2 * time.Second
+	// the longest match a local setup can ask for
+	maxWinsNeeded = 20
+	// the biggest speed-up allowed in a single step
+	maxSpeedUpPercent = 50
+	// replays of local games are saved in the working directory, like the log
+	localReplayFile = "local-%s.json"
+)
+
+var defaultLocalColors = [maxLocalPlayers]types.PlayerColor{
+	"#FF0000", "#00FF00", "#0000FF", "#FFFF00",
+}
+
+// localSetup holds the settings of a local game while the user edits them.
+// Key bindings and bots are kept per seat, they are turned into settings when
+// the game starts.
+type localSetup struct {
+	settings GameSettings
+	names    []string
+	colors   []types.PlayerColor
+	teams    []int
+	keys     []KeyBinding
+	// strategy of the bot playing the seat, empty for humans
+	bots         []string
+	difficulties []Difficulty
+}
+
+func newLocalSetup() *localSetup {
+	s := &localSetup{
+		settings: NewGameSettings(60, 30),
+	}
+	s.setPlayerCount(minLocalPlayers)
+	return s
+}
+
+func (s *localSetup) setPlayerCount(n int) {
+	for len(s.names) < n {
+		s.names = append(s.names, fmt.Sprintf("Player %d", len(s.names)+1))
+		s.colors = append(s.colors, defaultLocalColors[len(s.colors)])
+		s.teams = append(s.teams, 0)
+		s.keys = append(s.keys, DefaultKeyBindings[len(s.keys)])
+		s.bots = append(s.bots, "")
+		s.difficulties = append(s.difficulties, Normal)
+	}
+	s.names = s.names[:n]
+	s.colors = s.colors[:n]
+	s.teams = s.teams[:n]
+	s.keys = s.keys[:n]
+	s.bots = s.bots[:n]
+	s.difficulties = s.difficulties[:n]
+}
+
+// humanKeys returns the key bindings of the human players in seat order.
+func (s *localSetup) humanKeys() []KeyBinding {
+	keys := make([]KeyBinding, 0, len(s.keys))
+	for i := range s.keys {
+		if s.bots[i] == "" {
+			keys = append(keys, s.keys[i])
+		}
+	}
+	return keys
+}
+
+// gameSettings completes the settings with the key bindings and the bots.
+func (s *localSetup) gameSettings() (GameSettings, error) {
+	settings := s.settings
+	settings.KeyBindings = s.humanKeys()
+	settings.Bots = make([]Bot, len(s.bots))
+	for i, strategy := range s.bots {
+		if strategy == "" {
+			continue
+		}
+		bot, err := NewBot(strategy, s.difficulties[i], time.Now().UnixNano()+int64(i))
+		if err != nil {
+			return settings, err
+		}
+		settings.Bots[i] = bot
+	}
+	return settings, nil
+}
+
+var localSetupHelp = []string{
+	"size WIDTH HEIGHT: set arena size",
+	"players N: set number of players (2-4)",
+	"name N NAME: set name of player N",
+	"color N #RRGGBB: set color of player N",
+	"keys N KEYS: set keys of player N in order up, left, down, right, boost, e.g. 'ijklo' or 'arrows'",
+	"bot N STRATEGY [DIFFICULTY]: let a bot play player N, strategies: " +
+		strings.Join(BotStrategies, ", ") + ", exec:PROGRAM, exec-delta:PROGRAM" +
+		", difficulty: easy, normal, hard",
+	"human N: let a human play player N",
+	"team N T: put player N in team T, 0 to play alone",
+	"passable on|off: let teammates pass through each other's trails",
+	"speed MS: set time between steps in milliseconds",
+	"speedup N P|off: make steps P percent faster every N ticks",
+	"suddendeath T: close the walls in after T ticks, 0 for never",
+	"trail N: limit trails to N cells like snakes, 0 for no limit",
+	"fade T: let trails fade after T ticks, 0 for never",
+	"powerups on|off: spawn speed (S), jump (J) and ghost (G) power-ups",
+	"wins N: play rounds until someone wins N times, 0 for a single round",
+	"walls solid|wrap|shrink [N]: set arena walls, shrinking walls close in every N ticks",
+	"map NAME|FILE|none: play on a map with obstacles, bundled maps: " +
+		strings.Join(BundledMaps(), ", "),
+	"start: start the game, press 'q' in game to return",
+	"cancel: return to lobby",
+}
+
+func (s *localSetup) show(c *LobbyEngine) {
+	if m := s.settings.Map; m != nil {
+		c.PushMessage(sys_n, "Map: %s (%dx%d)", m.Name, m.Width, m.Height)
+	}
+	c.PushMessage(sys_n, "Arena: %dx%d, walls: %s, speed: %d ms, wins needed: %d, power-ups: %t",
+		s.settings.Width, s.settings.Height, s.settings.Walls,
+		s.settings.TickTime.Milliseconds(), s.settings.WinsNeeded, s.settings.PowerUps)
+	if sp := s.settings.SpeedUp; sp.Every > 0 {
+		c.PushMessage(sys_n, "Speed-up: %d%% every %d ticks", sp.Percent, sp.Every)
+	}
+	if s.settings.SuddenDeath > 0 {
+		c.PushMessage(sys_n, "Sudden death after %d ticks", s.settings.SuddenDeath)
+	}
+	if s.settings.TrailLength > 0 {
+		c.PushMessage(sys_n, "Trails are at most %d cells long", s.settings.TrailLength)
+	}
+	if s.settings.TrailFade > 0 {
+		c.PushMessage(sys_n, "Trails fade after %d ticks", s.settings.TrailFade)
+	}
+	for i := range s.names {
+		team := ""
+		if s.teams[i] > 0 {
+			team = fmt.Sprintf(", Team: %d", s.teams[i])
+		}
+		if s.bots[i] != "" {
+			c.PushMessage(sys_n, "Player %d: %s, Color: %s, Bot: %s%s", i+1, s.names[i],
+				s.colors[i], s.bots[i], team)
+		} else {
+			c.PushMessage(sys_n, "Player %d: %s, Color: %s%s", i+1, s.names[i], s.colors[i], team)
+		}
+	}
+	if hasTeams(s.players()) {
+		c.PushMessage(sys_n, "Teammates' trails are passable: %t", s.settings.TeamPassable)
+	}
+}
+
+// edit lets the user change the settings through the chat window. It returns
+// false if the setup is cancelled.
+func (s *localSetup) edit(c *LobbyEngine) bool {
+	c.PushMessage(sys_n, "Local game setup. Commands:")
+	for _, line := range localSetupHelp {
+		c.PushMessage(sys_n, line)
+	}
+	s.show(c)
+	for {
+		msg, _ := c.chatGui.FetchOne()
+		words := strings.Fields(msg)
+		if msg == "" {
+			return false
+		}
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "start":
+			return true
+		case "cancel":
+			c.PushMessage(sys_n, "Local game cancelled")
+			return false
+		}
+		if err := s.apply(words[0], words[1:]); err != nil {
+			c.PushError("%s", err.Error())
+			continue
+		}
+		s.show(c)
+	}
+}
+
+func (s *localSetup) apply(setting string, args []string) error {
+	nums := make([]int, 0, len(args))
+	for _, a := range args {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			break
+		}
+		nums = append(nums, n)
+	}
+	switch setting {
+	case "size":
+		if len(nums) != 2 {
+			return fmt.Errorf("Usage: size WIDTH HEIGHT")
+		}
+		for _, n := range nums {
+			if n < minArenaSize || n > maxArenaSize {
+				return fmt.Errorf("Arena size should be between %d and %d",
+					minArenaSize, maxArenaSize)
+			}
+		}
+		s.settings.Width, s.settings.Height = nums[0], nums[1]
+		s.settings.Map = nil
+	case "players":
+		if len(nums) != 1 || nums[0] < minLocalPlayers || nums[0] > maxLocalPlayers {
+			return fmt.Errorf("Number of players should be between %d and %d",
+				minLocalPlayers, maxLocalPlayers)
+		}
+		if m := s.settings.Map; m != nil && nums[0] > len(m.Spawns) {
+			return fmt.Errorf("Map '%s' has only %d spawns", m.Name, len(m.Spawns))
+		}
+		s.setPlayerCount(nums[0])
+	case "passable":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return fmt.Errorf("Usage: passable on|off")
+		}
+		s.settings.TeamPassable = args[0] == "on"
+	case "name", "color", "keys", "bot", "human", "team":
+		if len(nums) < 1 {
+			return fmt.Errorf("Usage: %s N ...", setting)
+		}
+		i := nums[0] - 1
+		if i < 0 || i >= len(s.names) {
+			return fmt.Errorf("Unknown player: %d", nums[0])
+		}
+		return s.applyPlayer(setting, i, args[1:])
+	case "speed":
+		if len(nums) != 1 {
+			return fmt.Errorf("Usage: speed MS")
+		}
+		t := time.Duration(nums[0]) * time.Millisecond
+		if t < minTickTime || t > maxTickTime {
+			return fmt.Errorf("Speed should be between %d and %d ms",
+				minTickTime.Milliseconds(), maxTickTime.Milliseconds())
+		}
+		s.settings.TickTime = t
+	case "speedup":
+		if len(args) == 1 && args[0] == "off" {
+			s.settings.SpeedUp = TickSchedule{}
+			return nil
+		}
+		if len(nums) != 2 || nums[0] < 1 || nums[1] < 1 || nums[1] > maxSpeedUpPercent {
+			return fmt.Errorf("Usage: speedup N P|off, where P is at most %d", maxSpeedUpPercent)
+		}
+		s.settings.SpeedUp = TickSchedule{Every: nums[0], Percent: nums[1]}
+	case "suddendeath":
+		if len(nums) != 1 || nums[0] < 0 {
+			return fmt.Errorf("Usage: suddendeath T")
+		}
+		s.settings.SuddenDeath = nums[0]
+	case "trail":
+		if len(nums) != 1 || (nums[0] != 0 && nums[0] < minTrailLength) {
+			return fmt.Errorf("Trails should be at least %d cells long, or 0 for no limit",
+				minTrailLength)
+		}
+		s.settings.TrailLength = nums[0]
+	case "fade":
+		if len(nums) != 1 || nums[0] < 0 {
+			return fmt.Errorf("Usage: fade T")
+		}
+		s.settings.TrailFade = nums[0]
+	case "walls":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("Usage: walls solid|wrap|shrink [N]")
+		}
+		walls, err := ParseWallMode(args[0])
+		if err != nil {
+			return err
+		}
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("Walls should close in after at least 1 tick")
+			}
+			s.settings.ShrinkEvery = n
+		}
+		s.settings.Walls = walls
+	case "map":
+		if len(args) != 1 {
+			return fmt.Errorf("Usage: map NAME|FILE|none")
+		}
+		if args[0] == "none" {
+			s.settings.Map = nil
+			return nil
+		}
+		m, err := LoadMap(args[0])
+		if err != nil {
+			return err
+		}
+		if len(m.Spawns) < len(s.names) {
+			return fmt.Errorf("Map '%s' has only %d spawns", m.Name, len(m.Spawns))
+		}
+		s.settings.Map = m
+		s.settings.Width, s.settings.Height = m.Width, m.Height
+	case "powerups":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return fmt.Errorf("Usage: powerups on|off")
+		}
+		s.settings.PowerUps = args[0] == "on"
+	case "wins":
+		if len(nums) != 1 || nums[0] < 0 || nums[0] > maxWinsNeeded {
+			return fmt.Errorf("Wins needed should be between 0 and %d", maxWinsNeeded)
+		}
+		s.settings.WinsNeeded = nums[0]
+	default:
+		return fmt.Errorf("Unknown setting: '%s'", setting)
+	}
+	return nil
+}
+
+func (s *localSetup) applyPlayer(setting string, i int, args []string) error {
+	switch setting {
+	case "human":
+		s.bots[i] = ""
+		return nil
+	case "bot":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("Usage: bot N STRATEGY [DIFFICULTY]")
+		}
+		d := Normal
+		if len(args) > 1 {
+			var err error
+			if d, err = ParseDifficulty(args[1]); err != nil {
+				return err
+			}
+		}
+		if _, err := NewBot(args[0], d, 0); err != nil {
+			return err
+		}
+		s.bots[i] = args[0]
+		s.difficulties[i] = d
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: %s N VALUE", setting)
+	}
+	value := args[0]
+	switch setting {
+	case "team":
+		team, err := strconv.Atoi(value)
+		if err != nil || team < 0 || team > maxTeams {
+			return fmt.Errorf("Team should be between 0 and %d", maxTeams)
+		}
+		s.teams[i] = team
+	case "name":
+		if len(value) > 30 || len(value) < 3 {
+			return fmt.Errorf("Length of name should be between 3 and 30")
+		}
+		s.names[i] = value
+	case "color":
+		if !isHexColor(value) {
+			return fmt.Errorf("Color should be in #RRGGBB format")
+		}
+		for j, c := range s.colors {
+			if j != i && strings.EqualFold(string(c), value) {
+				return fmt.Errorf("Color is already used by player %d", j+1)
+			}
+		}
+		s.colors[i] = types.PlayerColor(strings.ToUpper(value))
+	case "keys":
+		b, err := ParseKeyBinding(value)
+		if err != nil {
+			return err
+		}
+		old := s.keys[i]
+		s.keys[i] = b
+		humanKeys := s.humanKeys()
+		if err = validateKeyBindings(humanKeys, len(humanKeys)); err != nil {
+			s.keys[i] = old
+			return err
+		}
+	}
+	return nil
+}
+
+func isHexColor(s string) bool {
+	if len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 16, 32)
+	return err == nil
+}
+
+// players places the players evenly in the arena, facing the center.
+func (s *localSetup) players() []playerData {
+	w, h := s.settings.Width, s.settings.Height
+	spawns := [maxLocalPlayers]struct {
+		pos gui.Position
+		dir types.Direction
+	}{
+		{gui.Position{X: w / 4, Y: h / 2}, types.Right},
+		{gui.Position{X: w - 1 - w/4, Y: h / 2}, types.Left},
+		{gui.Position{X: w / 2, Y: h / 4}, types.Down},
+		{gui.Position{X: w / 2, Y: h - 1 - h/4}, types.Up},
+	}
+	players := make([]playerData, len(s.names))
+	for i := range players {
+		players[i] = playerData{
+			history: []gui.Position{spawns[i].pos},
+			color:   s.colors[i],
+			dir:     spawns[i].dir,
+			name:    s.names[i],
+			team:    s.teams[i],
+		}
+	}
+	return players
+}
+
+func executeLocal(c *LobbyEngine, _ ...string) {
+	if c.net != nil {
+		c.PushMessage(sys_n, "You are connected. Disconnect first with: '/disc[onnect]'")
+		return
+	}
+	c.StartLocal()
+}
+
+// StartLocal opens the setup of a local game, runs the game and returns to
+// the lobby afterwards.
+func (c *LobbyEngine) StartLocal() {
+	setup := newLocalSetup()
+	if !setup.edit(c) {
+		return
+	}
+
+	// the game takes over the terminal
+	guik := types.Headless
+	if c.guiType == types.NCursesLobby {
+		c.chatGui.Close()
+		guik = types.NCursesGame
+	}
+	settings, err := setup.gameSettings()
+	var game *Game
+	if err == nil {
+		game, err = NewGame(settings, setup.players(), guik, nil, "")
+	}
+	if err == nil {
+		game.Wait()
+		game.Close()
+	}
+	if c.guiType == types.NCursesLobby {
+		c.chatGui = newChatGui(c.guiType)
+		c.setUpChatGui()
+	}
+
+	if err != nil {
+		log.Printf("Unable to start local game: %s", err.Error())
+		c.PushError("Unable to start local game: %s", err.Error())
+		return
+	}
+	c.PushMessage(sys_n, "Local game finished")
+	path := fmt.Sprintf(localReplayFile, time.Now().Format("20060102-150405"))
+	if err = game.Replay().Save(path); err != nil {
+		c.PushError("Unable to save replay: %s", err.Error())
+	} else {
+		c.PushMessage(sys_n, "Replay of the last round saved, watch it with: -replay %s", path)
+	}
+	if m := game.Match(); m != nil {
+		c.PushMessage(sys_n, "Final standings:")
+		for _, line := range m.Standings() {
+			c.PushMessage(sys_n, "%s", line)
+		}
+	}
+}
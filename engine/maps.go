@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Maps are either JSON encoded types.Map values or text files drawing the
+// arena row by row:
+//
+//	; lines starting with ';' are comments
+//	..........
+//	.>..##..<.
+//	..........
+//
+// '.' is a free cell, '#' is an obstacle and '^', 'v', '<', '>' are spawn
+// points facing the given direction. Spawns are used in the order they
+// appear, row by row.
+
+//go:embed maps/*.txt
+var bundledMapFiles embed.FS
+
+var spawnGlyphs = map[byte]types.Direction{
+	'^': types.Up,
+	'v': types.Down,
+	'<': types.Left,
+	'>': types.Right,
+}
+
+// BundledMaps returns the names of the maps shipped with the game.
+func BundledMaps() []string {
+	entries, err := bundledMapFiles.ReadDir("maps")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadMap loads a bundled map by name, or a map file from the given path.
+func LoadMap(name string) (*types.Map, error) {
+	data, err := bundledMapFiles.ReadFile("maps/" + name + ".txt")
+	if err != nil {
+		if data, err = os.ReadFile(name); err != nil {
+			return nil, fmt.Errorf("Unknown map: '%s'", name)
+		}
+		name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	return ParseMap(name, data)
+}
+
+// ParseMap decodes a map in JSON or text format and validates it. The name is
+// used if the map does not have one.
+func ParseMap(name string, data []byte) (*types.Map, error) {
+	var m *types.Map
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		m = &types.Map{}
+		err = json.Unmarshal(data, m)
+	} else {
+		m, err = parseTextMap(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		m.Name = name
+	}
+	if err = validateMap(m); err != nil {
+		return nil, fmt.Errorf("Invalid map '%s': %s", m.Name, err.Error())
+	}
+	return m, nil
+}
+
+func parseTextMap(data []byte) (*types.Map, error) {
+	m := &types.Map{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r \t")
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		if m.Height == 0 {
+			m.Width = len(line)
+		} else if len(line) != m.Width {
+			return nil, fmt.Errorf("Row %d of map should be %d cells wide", m.Height+1, m.Width)
+		}
+		for x := 0; x < len(line); x++ {
+			cell := types.Cell{X: x, Y: m.Height}
+			switch c := line[x]; c {
+			case '.':
+			case '#':
+				m.Obstacles = append(m.Obstacles, cell)
+			default:
+				dir, ok := spawnGlyphs[c]
+				if !ok {
+					return nil, fmt.Errorf("Unknown map cell '%c' at %d, %d", c, x, m.Height)
+				}
+				m.Spawns = append(m.Spawns, types.Spawn{Pos: cell, Dir: dir})
+			}
+		}
+		m.Height++
+	}
+	return m, nil
+}
+
+// validateMap checks that obstacles and spawns are inside the arena and do not
+// overlap, every spawn can make its first step, and the players can reach
+// each other.
+func validateMap(m *types.Map) error {
+	if m.Width < minArenaSize || m.Width > maxArenaSize ||
+		m.Height < minArenaSize || m.Height > maxArenaSize {
+		return fmt.Errorf("Arena size should be between %d and %d", minArenaSize, maxArenaSize)
+	}
+	inside := func(c types.Cell) bool {
+		return c.X >= 0 && c.X < m.Width && c.Y >= 0 && c.Y < m.Height
+	}
+	obstacles := mapObstacles(m)
+	for _, c := range m.Obstacles {
+		if !inside(c) {
+			return fmt.Errorf("Obstacle out of arena: %d, %d", c.X, c.Y)
+		}
+	}
+	if len(obstacles) != len(m.Obstacles) {
+		return fmt.Errorf("Obstacles overlap")
+	}
+	if len(m.Spawns) < minLocalPlayers {
+		return fmt.Errorf("Map should have at least %d spawns", minLocalPlayers)
+	}
+
+	spawns := make(map[gui.Position]bool)
+	for _, s := range m.Spawns {
+		pos := gui.Position{X: s.Pos.X, Y: s.Pos.Y}
+		if !inside(s.Pos) {
+			return fmt.Errorf("Spawn out of arena: %d, %d", pos.X, pos.Y)
+		}
+		if obstacles[pos] {
+			return fmt.Errorf("Spawn on an obstacle: %d, %d", pos.X, pos.Y)
+		}
+		if spawns[pos] {
+			return fmt.Errorf("Spawns overlap: %d, %d", pos.X, pos.Y)
+		}
+		spawns[pos] = true
+		switch s.Dir {
+		case types.Up, types.Down, types.Left, types.Right:
+		default:
+			return fmt.Errorf("Invalid direction of spawn at %d, %d: '%s'", pos.X, pos.Y, s.Dir)
+		}
+	}
+	for _, s := range m.Spawns {
+		next := move(gui.Position{X: s.Pos.X, Y: s.Pos.Y}, s.Dir)
+		if !inside(types.Cell{X: next.X, Y: next.Y}) || obstacles[next] || spawns[next] {
+			return fmt.Errorf("Spawn at %d, %d is facing a wall", s.Pos.X, s.Pos.Y)
+		}
+	}
+
+	// every spawn should be reachable from the first one
+	first := gui.Position{X: m.Spawns[0].Pos.X, Y: m.Spawns[0].Pos.Y}
+	reached := map[gui.Position]bool{first: true}
+	queue := []gui.Position{first}
+	for len(queue) > 0 {
+		pos := queue[0]
+		queue = queue[1:]
+		for _, d := range []types.Direction{types.Up, types.Down, types.Left, types.Right} {
+			next := move(pos, d)
+			if inside(types.Cell{X: next.X, Y: next.Y}) && !obstacles[next] && !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	for pos := range spawns {
+		if !reached[pos] {
+			return fmt.Errorf("Spawn at %d, %d is unreachable", pos.X, pos.Y)
+		}
+	}
+	return nil
+}
+
+// mapObstacles returns the set of obstacle cells, it is nil without a map.
+func mapObstacles(m *types.Map) map[gui.Position]bool {
+	if m == nil {
+		return nil
+	}
+	obstacles := make(map[gui.Position]bool, len(m.Obstacles))
+	for _, c := range m.Obstacles {
+		obstacles[gui.Position{X: c.X, Y: c.Y}] = true
+	}
+	return obstacles
+}
+
+// placeOnSpawns moves the players to the spawns of the map in seat order.
+func placeOnSpawns(m *types.Map, players []playerData) ([]playerData, error) {
+	if len(players) > len(m.Spawns) {
+		return nil, fmt.Errorf("Map '%s' has only %d spawns for %d players",
+			m.Name, len(m.Spawns), len(players))
+	}
+	placed := copyPlayers(players)
+	for i := range placed {
+		s := m.Spawns[i]
+		placed[i].history = []gui.Position{{X: s.Pos.X, Y: s.Pos.Y}}
+		placed[i].dir = s.Dir
+	}
+	return placed, nil
+}
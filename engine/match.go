@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/types"
+	"sort"
+)
+
+const (
+	// number of ticks the scoreboard is shown between two rounds
+	roundBreakTicks = 8
+	// points given for each player whose death was caused by your trail
+	killPoints = 1
+)
+
+type score struct {
+	color  types.PlayerColor
+	name   string
+	wins   int
+	points int
+	kills  int
+}
+
+// Match plays rounds until a player reaches the needed number of wins. In team
+// games teammates share their wins.
+// Players get a point for every player they survived and for every kill.
+type Match struct {
+	winsNeeded int
+	round      int
+	// winner of the last round, empty in case of a draw
+	lastWinner string
+	scores     []score
+}
+
+func NewMatch(players []playerData, winsNeeded int) *Match {
+	m := &Match{
+		winsNeeded: winsNeeded,
+		scores:     make([]score, len(players)),
+	}
+	for i, p := range players {
+		m.scores[i] = score{color: p.color, name: p.name}
+	}
+	return m
+}
+
+func (m *Match) scoreByColor(c types.PlayerColor) *score {
+	for i := range m.scores {
+		if m.scores[i].color == c {
+			return &m.scores[i]
+		}
+	}
+	return nil
+}
+
+// addRound scores the final state of a round. Every member of the winning
+// team gets a win, including the ones who died.
+func (m *Match) addRound(s gameState) {
+	m.round++
+	m.lastWinner = s.winnerName()
+	winner := s.winnerSide()
+	for _, p := range s.players {
+		sc := m.scoreByColor(p.color)
+		if sc == nil {
+			continue
+		}
+		// survival points, players still alive outlived everyone who died
+		for _, other := range s.players {
+			if other.isDead && (!p.isDead || other.deathTick < p.deathTick) {
+				sc.points++
+			}
+		}
+		if winner != "" && p.side() == winner {
+			sc.wins++
+		}
+		if killer := m.scoreByColor(p.killer); p.isDead && killer != nil {
+			killer.kills++
+			killer.points += killPoints
+		}
+	}
+}
+
+// Finished tells if a player has reached the needed number of wins.
+func (m *Match) Finished() bool {
+	for _, sc := range m.scores {
+		if sc.wins >= m.winsNeeded {
+			return true
+		}
+	}
+	return false
+}
+
+// Standings lists the players ordered by wins, then points.
+func (m *Match) Standings() []string {
+	sorted := append([]score(nil), m.scores...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].wins != sorted[j].wins {
+			return sorted[i].wins > sorted[j].wins
+		}
+		return sorted[i].points > sorted[j].points
+	})
+	lines := make([]string, len(sorted))
+	for i, sc := range sorted {
+		lines[i] = fmt.Sprintf("%d. %s: %d wins, %d points, %d kills",
+			i+1, sc.name, sc.wins, sc.points, sc.kills)
+	}
+	return lines
+}
+
+// scoreboard is shown in the game between rounds and at the end.
+func (m *Match) scoreboard() []string {
+	var title string
+	if m.lastWinner == "" {
+		title = fmt.Sprintf("Round %d is a draw", m.round)
+	} else {
+		title = fmt.Sprintf("Round %d winner: %s", m.round, m.lastWinner)
+	}
+	lines := []string{title, ""}
+	lines = append(lines, m.Standings()...)
+	lines = append(lines, "")
+	if m.Finished() {
+		lines = append(lines, "Match is over, press 'q' to leave")
+	} else {
+		lines = append(lines, fmt.Sprintf("First to %d wins", m.winsNeeded))
+	}
+	return lines
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tron_client/client"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"log"
+)
+
+// RunNetBot joins a server as a player controlled by the bot, in the given
+// room or in a new one if it is empty. It readies up for every game and
+// returns when the connection is lost, or after the current game when stop is
+// closed.
+func RunNetBot(address string, port int, room string, name string, bot Bot,
+	stop chan bool) error {
+	defer closeBots([]Bot{bot})
+	cli, err := client.Connect(address, port)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	resp, err := cli.ConnectRequest(name, room, "private")
+	if err != nil {
+		return err
+	}
+	log.Printf("Bot %s: connected with color %s", name, resp.Color)
+	go cli.Listen()
+
+	if err = sendReady(cli); err != nil {
+		return err
+	}
+	for {
+		var m types.JsonMsgI
+		var ok bool
+		select {
+		case <-stop:
+			return fmt.Errorf("Removed from the server")
+		case m, ok = <-cli.Msgs:
+		}
+		if !ok {
+			return fmt.Errorf("Connection to server lost")
+		}
+		if m.GetType() != "start_game" {
+			continue
+		}
+		start := m.(*types.StartGameMsg)
+		settings := NewGameSettings(start.Width, start.Height)
+		settings.Bots = []Bot{bot}
+		if start.Walls != "" {
+			if settings.Walls, err = ParseWallMode(start.Walls); err != nil {
+				return err
+			}
+			settings.ShrinkEvery = start.ShrinkEvery
+		}
+		if start.Map != nil {
+			if err = validateMap(start.Map); err != nil {
+				return err
+			}
+			settings.Map = start.Map
+		}
+		settings.PowerUps, settings.Seed = start.PowerUps, start.Seed
+		settings.TeamPassable = start.TeamPassable
+		settings.SuddenDeath = start.SuddenDeath
+		settings.TrailLength, settings.TrailFade = start.TrailLength, start.TrailFade
+		game, err := NewGame(settings, startingPlayers(start), types.Headless, cli, resp.Color)
+		if err != nil {
+			return err
+		}
+		game.Wait()
+		game.Close()
+		log.Printf("Bot %s: game over", name)
+
+		if err = sendReady(cli); err != nil {
+			return err
+		}
+	}
+}
+
+func sendReady(cli *client.Client) error {
+	bytes, err := json.Marshal(&types.ReadyMsg{
+		JsonMsg: &types.JsonMsg{Type: "ready"},
+		Value:   true,
+	})
+	if err != nil {
+		return err
+	}
+	return cli.SendMessage(bytes)
+}
+
+// startingPlayers creates the players from the start message of the server.
+func startingPlayers(start *types.StartGameMsg) []playerData {
+	players := make([]playerData, len(start.Players))
+	for i, p := range start.Players {
+		players[i] = playerData{
+			history: []gui.Position{{X: p.Pos.X, Y: p.Pos.Y}},
+			color:   p.Color,
+			dir:     p.Dir,
+			name:    p.Name,
+			team:    p.Team,
+		}
+	}
+	return players
+}
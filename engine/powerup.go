@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"math/rand"
+)
+
+type PowerUp string
+
+const (
+	// SpeedBoost moves the player two cells per tick
+	SpeedBoost PowerUp = "speed"
+	// Jump lets the player jump over the next cell, leaving a gap in its trail
+	Jump PowerUp = "jump"
+	// Ghost lets the player pass through trails
+	Ghost PowerUp = "ghost"
+)
+
+var powerUps = [...]PowerUp{SpeedBoost, Jump, Ghost}
+
+const (
+	// number of ticks between two spawned items
+	powerUpEvery = 15
+	// the most items waiting on the board at the same time
+	maxItems = 3
+	// number of tries to find a free cell for a new item
+	itemPlaceTries = 20
+)
+
+// duration of the power-ups in ticks
+var powerUpTicks = map[PowerUp]int{
+	SpeedBoost: 5,
+	Jump:       1,
+	Ghost:      6,
+}
+
+// items are drawn with the first letter of their kind
+var itemGlyphs = map[PowerUp]byte{
+	SpeedBoost: 'S',
+	Jump:       'J',
+	Ghost:      'G',
+}
+
+func ParsePowerUp(s string) (PowerUp, error) {
+	switch p := PowerUp(s); p {
+	case SpeedBoost, Jump, Ghost:
+		return p, nil
+	}
+	return "", fmt.Errorf("Unknown power-up: '%s'", s)
+}
+
+// item is a power-up waiting on the board.
+type item struct {
+	pos  gui.Position
+	kind PowerUp
+}
+
+// path returns the cells the player passes in the next tick. Speed boosts and
+// boosting add a cell each. A jumping player skips the first cell, so it is
+// not part of the path.
+func (s gameState) path(p playerData, boost bool) []gui.Position {
+	length := 1
+	if p.powerUp == SpeedBoost {
+		length++
+	}
+	if boost {
+		length++
+	}
+	pos := p.history[len(p.history)-1]
+	if p.powerUp == Jump {
+		pos = s.step(pos, p.dir)
+	}
+	path := make([]gui.Position, length)
+	for i := range path {
+		pos = s.step(pos, p.dir)
+		path[i] = pos
+	}
+	return path
+}
+
+// takeItem removes the item from the cell and returns its kind.
+func (s *gameState) takeItem(pos gui.Position) (PowerUp, bool) {
+	for i, it := range s.items {
+		if it.pos == pos {
+			s.items = append(s.items[:i:i], s.items[i+1:]...)
+			return it.kind, true
+		}
+	}
+	return "", false
+}
+
+// spawnItem places a new item on a free cell every powerUpEvery ticks. The
+// random generator is seeded by the seed of the game and the tick, so the
+// same game spawns the same items when simulated again.
+func (s *gameState) spawnItem() {
+	if !s.rules.powerUps || s.tick%powerUpEvery != 0 || len(s.items) >= maxItems {
+		return
+	}
+	rnd := rand.New(rand.NewSource(s.rules.seed + int64(s.tick)))
+	taken := make(map[gui.Position]bool)
+	for _, p := range s.players {
+		for _, h := range p.history {
+			taken[h] = true
+		}
+	}
+	for _, it := range s.items {
+		taken[it.pos] = true
+	}
+	kind := powerUps[rnd.Intn(len(powerUps))]
+	for try := 0; try < itemPlaceTries; try++ {
+		pos := gui.Position{X: rnd.Intn(s.size.width), Y: rnd.Intn(s.size.height)}
+		if !s.blocked(pos) && !taken[pos] {
+			s.items = append(s.items, item{pos: pos, kind: kind})
+			return
+		}
+	}
+}
+
+func (s gameState) msgItems() []types.Item {
+	items := make([]types.Item, len(s.items))
+	for i, it := range s.items {
+		items[i] = types.Item{Pos: types.Cell{X: it.pos.X, Y: it.pos.Y}, Kind: string(it.kind)}
+	}
+	return items
+}
+
+// setItems replaces the items on the board with the ones told by the server.
+func (s *gameState) setItems(items []types.Item) error {
+	s.items = make([]item, 0, len(items))
+	for _, it := range items {
+		kind, err := ParsePowerUp(it.Kind)
+		if err != nil {
+			return err
+		}
+		s.items = append(s.items, item{pos: gui.Position{X: it.Pos.X, Y: it.Pos.Y}, kind: kind})
+	}
+	return nil
+}
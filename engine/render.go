@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"strings"
+)
+
+// redraw draws the whole board from the state of the game.
+func (g *Game) redraw() {
+	g.gameGui.BeginFrame()
+	defer g.gameGui.EndFrame()
+	g.gameGui.Reset()
+	g.gameGui.SetLegend(g.legend())
+	g.gameGui.SetBorder(g.state.border())
+	g.drawItems(nil, g.state.items)
+	for _, b := range g.blocks() {
+		g.gameGui.SetCell(b.Pos, blockCell(b))
+	}
+	g.drawHeads()
+	g.gameGui.SetStatus(g.state.status())
+}
+
+// drawItems clears the items that left the board and draws the new ones.
+// Cells taken by a trail are left alone.
+func (g *Game) drawItems(old []item, new []item) {
+	taken := make(map[gui.Position]bool)
+	for _, p := range g.state.players {
+		for _, h := range p.history {
+			taken[h] = true
+		}
+	}
+	for _, it := range old {
+		if !taken[it.pos] {
+			g.gameGui.ClearCell(it.pos)
+		}
+	}
+	for _, it := range new {
+		if !taken[it.pos] {
+			g.gameGui.SetCell(it.pos, gui.Cell{Glyph: itemGlyphs[it.kind]})
+		}
+	}
+}
+
+// drawHeads moves the head markers of the living players to their last cell.
+func (g *Game) drawHeads() {
+	for _, p := range g.state.players {
+		if p.isDead || len(p.history) == 0 {
+			g.gameGui.ClearHead(p.color)
+			continue
+		}
+		g.gameGui.SetHead(p.color, p.history[len(p.history)-1])
+	}
+}
+
+func (g *Game) legend() []gui.LegendEntry {
+	entries := make([]gui.LegendEntry, len(g.state.players))
+	for i, p := range g.state.players {
+		entries[i] = gui.LegendEntry{Color: p.color, Team: p.team, Name: p.name}
+	}
+	return entries
+}
+
+func blockCell(b gui.PlayerBlock) gui.Cell {
+	return gui.Cell{Color: b.Color, Team: b.Team}
+}
+
+// status returns the line shown under the board: the tick and the energy of
+// the players in units of boosted ticks.
+func (s gameState) status() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Tick %d", s.tick)
+	for _, p := range s.players {
+		level := p.energy() / boostCost
+		if p.isDead {
+			level = 0
+		}
+		bar := strings.Repeat("=", level) + strings.Repeat("-", maxEnergy/boostCost-level)
+		name := p.name
+		if name == "" {
+			name = string(p.color)
+		}
+		fmt.Fprintf(&sb, "  %s [%s]", name, bar)
+	}
+	return sb.String()
+}
@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"os"
+	"time"
+)
+
+// Replay is a recorded game: the arena, the starting state of every player
+// and the turns of the players for each tick.
+type Replay struct {
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Walls       WallMode   `json:"walls,omitempty"`
+	ShrinkEvery int        `json:"shrink_every,omitempty"`
+	Map         *types.Map `json:"map,omitempty"`
+	PowerUps    bool       `json:"powerups,omitempty"`
+	Seed        int64      `json:"seed,omitempty"`
+	// TeamPassable lets players pass through the trails of their teammates
+	TeamPassable bool `json:"team_passable,omitempty"`
+	SuddenDeath  int  `json:"sudden_death,omitempty"`
+	TrailLength  int  `json:"trail_length,omitempty"`
+	TrailFade    int  `json:"trail_fade,omitempty"`
+	// TickTime and SpeedUp pace the playback like the recorded game
+	TickTime time.Duration        `json:"tick_time,omitempty"`
+	SpeedUp  TickSchedule         `json:"speed_up"`
+	Players  []ReplayPlayer       `json:"players"`
+	Ticks    [][]types.GameChange `json:"ticks"`
+}
+
+type ReplayPlayer struct {
+	Color   types.PlayerColor `json:"color"`
+	Name    string            `json:"name"`
+	Team    int               `json:"team,omitempty"`
+	Dir     types.Direction   `json:"direction"`
+	History []gui.Position    `json:"history"`
+}
+
+// NewReplay starts recording a game from the given state.
+func NewReplay(s gameState) *Replay {
+	r := &Replay{
+		Width:        s.size.width,
+		Height:       s.size.height,
+		Walls:        s.rules.walls,
+		ShrinkEvery:  s.rules.shrinkEvery,
+		Map:          s.rules.arenaMap,
+		PowerUps:     s.rules.powerUps,
+		Seed:         s.rules.seed,
+		TeamPassable: s.rules.teamPassable,
+		SuddenDeath:  s.rules.suddenDeath,
+		TrailLength:  s.rules.trailLength,
+		TrailFade:    s.rules.trailFade,
+		TickTime:     s.rules.tickTime,
+		SpeedUp:      s.rules.speedUp,
+		Players:      make([]ReplayPlayer, 0, len(s.players)),
+		Ticks:        make([][]types.GameChange, 0),
+	}
+	for _, p := range s.players {
+		r.Players = append(r.Players, ReplayPlayer{
+			Color:   p.color,
+			Name:    p.name,
+			Team:    p.team,
+			Dir:     p.dir,
+			History: append([]gui.Position(nil), p.history...),
+		})
+	}
+	return r
+}
+
+func LoadReplay(path string) (*Replay, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Replay{}
+	if err = json.Unmarshal(bytes, r); err != nil {
+		return nil, err
+	}
+	if err = r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validate checks that the replay can be played back: the arena, the
+// starting state of the players and the recorded turns.
+func (r *Replay) validate() error {
+	if r.Width <= 0 || r.Height <= 0 {
+		return fmt.Errorf("Invalid arena size: %dx%d", r.Width, r.Height)
+	}
+	if r.Map != nil {
+		if err := validateMap(r.Map); err != nil {
+			return err
+		}
+		if r.Map.Width != r.Width || r.Map.Height != r.Height {
+			return fmt.Errorf("Size of map %s differs from the arena", r.Map.Name)
+		}
+	}
+	if len(r.Players) < 2 {
+		return fmt.Errorf("At least two players are needed")
+	}
+	colors := make(map[types.PlayerColor]bool)
+	for _, p := range r.Players {
+		if p.Color == "" || colors[p.Color] {
+			return fmt.Errorf("Missing or repeated player color: '%s'", p.Color)
+		}
+		colors[p.Color] = true
+		if !isDirection(p.Dir) {
+			return fmt.Errorf("Unknown direction of player %s: '%s'", p.Color, p.Dir)
+		}
+		if len(p.History) == 0 {
+			return fmt.Errorf("Empty history of player %s", p.Color)
+		}
+		for _, h := range p.History {
+			if h.X < 0 || h.X >= r.Width || h.Y < 0 || h.Y >= r.Height {
+				return fmt.Errorf("Cell of player %s out of the arena: %d, %d", p.Color, h.X, h.Y)
+			}
+		}
+	}
+	for tick, changes := range r.Ticks {
+		for _, change := range changes {
+			if !colors[change.Color] {
+				return fmt.Errorf("Unknown player at tick %d: '%s'", tick, change.Color)
+			}
+			if change.Dir != "" && change.Dir != types.Forfeit && !isDirection(change.Dir) {
+				return fmt.Errorf("Unknown direction at tick %d: '%s'", tick, change.Dir)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Replay) Save(path string) error {
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0666)
+}
+
+// AddTick records the inputs of the players for the next tick.
+func (r *Replay) AddTick(in inputs) {
+	changes := make([]types.GameChange, 0, len(in))
+	for color, action := range in {
+		changes = append(changes, types.GameChange{
+			Color: color,
+			Dir:   action.dir,
+			Boost: action.boost,
+		})
+	}
+	r.Ticks = append(r.Ticks, changes)
+}
+
+// inputs returns the recorded inputs of the given tick.
+func (r *Replay) inputs(tick int) inputs {
+	in := make(inputs)
+	for _, change := range r.Ticks[tick] {
+		if change.Dir != "" || change.Boost {
+			in[change.Color] = input{dir: change.Dir, boost: change.Boost}
+		}
+	}
+	return in
+}
+
+func (r *Replay) rules() gameRules {
+	rules := newGameRules(r.Walls, r.ShrinkEvery, r.Map)
+	rules.powerUps = r.PowerUps
+	rules.seed = r.Seed
+	rules.teamPassable = r.TeamPassable
+	rules.suddenDeath = r.SuddenDeath
+	rules.trailLength = r.TrailLength
+	rules.trailFade = r.TrailFade
+	rules.tickTime = r.TickTime
+	rules.speedUp = r.SpeedUp
+	return rules
+}
+
+func (r *Replay) startingPlayers() []playerData {
+	players := make([]playerData, 0, len(r.Players))
+	for _, p := range r.Players {
+		players = append(players, playerData{
+			history: append([]gui.Position(nil), p.History...),
+			color:   p.Color,
+			dir:     p.Dir,
+			name:    p.Name,
+			team:    p.Team,
+		})
+	}
+	return players
+}
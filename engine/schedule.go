@@ -0,0 +1,50 @@
+package engine
+
+import "time"
+
+// number of ticks between two moves of the walls in sudden death
+const suddenDeathShrinkEvery = 3
+
+// TickSchedule speeds a game up over time: after every Every ticks the time
+// between two ticks gets shorter by Percent, but not shorter than Min.
+type TickSchedule struct {
+	Every   int           `json:"every"`
+	Percent int           `json:"percent"`
+	Min     time.Duration `json:"min"`
+}
+
+// at returns the time between the given tick and the next one.
+func (t TickSchedule) at(base time.Duration, tick int) time.Duration {
+	if base <= 0 {
+		base = defaultTickTime
+	}
+	if t.Every <= 0 || t.Percent <= 0 {
+		return base
+	}
+	min := t.Min
+	if min <= 0 {
+		min = minTickTime
+	}
+	d := base
+	for i := 0; i < tick/t.Every && d > min; i++ {
+		d = d * time.Duration(100-t.Percent) / 100
+	}
+	if d < min {
+		return min
+	}
+	return d
+}
+
+// tickInterval is the time between the current tick and the next one.
+func (s gameState) tickInterval() time.Duration {
+	return s.rules.speedUp.at(s.rules.tickTime, s.tick)
+}
+
+// suddenDeathInset is the number of cells the walls have closed in since
+// sudden death started.
+func (s gameState) suddenDeathInset() int {
+	if s.rules.suddenDeath <= 0 || s.tick < s.rules.suddenDeath {
+		return 0
+	}
+	return (s.tick-s.rules.suddenDeath)/suddenDeathShrinkEvery + 1
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"github.com/tron_client/types"
+	"time"
+)
+
+const defaultShrinkEvery = 20
+
+// GameSettings configures a game.
+type GameSettings struct {
+	Width  int
+	Height int
+	// KeyBindings of the local players in seat order. Network games use the
+	// first one.
+	KeyBindings []KeyBinding
+	// Bots play the seats of the local players in seat order, nil stands for
+	// a human. In network games the first one plays instead of the user,
+	// empty seats of the server are filled by bots joining with RunNetBot.
+	Bots []Bot
+	// MaxTurns is the number of turns a player can queue up ahead of ticks.
+	MaxTurns int
+	// TickTime is the time elapsed between two steps of a local game.
+	TickTime time.Duration
+	// SpeedUp makes the ticks faster over time
+	SpeedUp TickSchedule
+	// SuddenDeath is the tick the walls start closing in at, 0 if never
+	SuddenDeath int
+	// Trails are not longer than TrailLength cells and fade after TrailFade
+	// ticks, 0 means no limit
+	TrailLength int
+	TrailFade   int
+	Walls       WallMode
+	// ShrinkEvery is the number of ticks between two moves of shrinking walls
+	ShrinkEvery int
+	// Map places obstacles in the arena, its size overrides Width and Height.
+	// Local players start from its spawns, in network games the server tells
+	// the starting positions.
+	Map *types.Map
+	// PowerUps are spawned from a random generator seeded with Seed
+	PowerUps bool
+	Seed     int64
+	// TeamPassable lets players pass through the trails of their teammates
+	TeamPassable bool
+	// WinsNeeded is the number of won rounds needed to win a local match. A
+	// single round is played if it is zero.
+	WinsNeeded int
+}
+
+func NewGameSettings(w int, h int) GameSettings {
+	return GameSettings{
+		Width:       w,
+		Height:      h,
+		KeyBindings: DefaultKeyBindings,
+		MaxTurns:    defaultMaxTurns,
+		TickTime:    defaultTickTime,
+		Walls:       SolidWalls,
+		ShrinkEvery: defaultShrinkEvery,
+		Seed:        time.Now().UnixNano(),
+	}
+}
@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"time"
+)
+
+// gameState is everything needed to compute the next tick of a game.
+type gameState struct {
+	tick    int
+	size    Size
+	rules   gameRules
+	players []playerData
+	items   []item
+}
+
+type WallMode string
+
+const (
+	// SolidWalls kill players running into them
+	SolidWalls WallMode = "solid"
+	// WrapWalls let players leaving the arena come back on the other side
+	WrapWalls WallMode = "wrap"
+	// ShrinkingWalls are solid and close in periodically, killing anyone left
+	// outside
+	ShrinkingWalls WallMode = "shrink"
+)
+
+func ParseWallMode(s string) (WallMode, error) {
+	switch m := WallMode(s); m {
+	case SolidWalls, WrapWalls, ShrinkingWalls:
+		return m, nil
+	}
+	return SolidWalls, fmt.Errorf("Unknown wall mode: '%s'", s)
+}
+
+// gameRules are the settings the simulation depends on besides the arena
+// size. They do not change during a game.
+type gameRules struct {
+	walls WallMode
+	// shrinkEvery is the number of ticks between two moves of shrinking walls
+	shrinkEvery int
+	// arenaMap is nil in an empty arena, obstacles are the cells of its
+	// obstacles
+	arenaMap  *types.Map
+	obstacles map[gui.Position]bool
+	// powerUps are spawned from a random generator seeded with seed
+	powerUps bool
+	seed     int64
+	// teamPassable lets players pass through the trails of their teammates
+	teamPassable bool
+	// suddenDeath is the tick the walls start closing in at, 0 if never
+	suddenDeath int
+	// trails are not longer than trailLength cells and fade after trailFade
+	// ticks, 0 means no limit
+	trailLength int
+	trailFade   int
+
+	// the pace of the game does not affect the simulation, but every mode
+	// uses the same schedule
+	tickTime time.Duration
+	speedUp  TickSchedule
+}
+
+func newGameRules(walls WallMode, shrinkEvery int, m *types.Map) gameRules {
+	return gameRules{
+		walls:       walls,
+		shrinkEvery: shrinkEvery,
+		arenaMap:    m,
+		obstacles:   mapObstacles(m),
+	}
+}
+
+// input is the action of a player for a single tick. The direction is empty if
+// the player does not turn.
+type input struct {
+	dir   types.Direction
+	boost bool
+}
+
+// inputs holds the actions of the players for a single tick, keyed by color.
+type inputs map[types.PlayerColor]input
+
+// simulate computes the state of the next tick from the current state and the
+// players' inputs for that tick. It does not modify the given state, and it
+// returns the blocks added to the board by the step and the cells freed by
+// decaying trails.
+func simulate(s gameState, in inputs) (gameState, []gui.PlayerBlock, []gui.Position) {
+	next := gameState{
+		tick:    s.tick + 1,
+		size:    s.size,
+		rules:   s.rules,
+		players: copyPlayers(s.players),
+		items:   append([]item(nil), s.items...),
+	}
+
+	// cells already taken by trails and their owners
+	occupied := make(map[gui.Position]types.PlayerColor)
+	teams := make(map[types.PlayerColor]int)
+	for _, p := range next.players {
+		teams[p.color] = p.team
+		for _, h := range p.history {
+			occupied[h] = p.color
+		}
+	}
+
+	// the shrinking walls kill the players they close over, even if they
+	// step inward at the same tick
+	if next.inset() != s.inset() {
+		for i := range next.players {
+			p := &next.players[i]
+			if !p.isDead && len(p.history) > 0 && !next.inArena(p.history[len(p.history)-1]) {
+				p.isDead = true
+				p.deathTick = next.tick
+			}
+		}
+	}
+
+	// turn and compute the cells passed by the players
+	paths := make([][]gui.Position, len(next.players))
+	pathCount := make(map[gui.Position]int)
+	for i := range next.players {
+		p := &next.players[i]
+		if p.isDead { // dead player won't step
+			continue
+		}
+		action := in[p.color]
+		if action.dir == types.Forfeit {
+			p.isDead = true
+			p.deathTick = next.tick
+			continue
+		}
+		if action.dir != "" {
+			p.changeDir(action.dir)
+		}
+		paths[i] = next.path(*p, p.useBoost(action.boost))
+		for _, pos := range paths[i] {
+			pathCount[pos]++
+		}
+	}
+
+	// step, players crashing into a wall, an obstacle, a trail or each other
+	// die. Ghosts pass through trails, and teammates through each other's
+	// trails if the rules allow.
+	new_blocks := make([]gui.PlayerBlock, 0, len(next.players))
+	for i := range next.players {
+		p := &next.players[i]
+		if p.isDead {
+			continue
+		}
+		var picked PowerUp
+		for _, pos := range paths[i] {
+			owner, hit := occupied[pos]
+			if p.powerUp == Ghost {
+				hit = false
+			}
+			if hit && next.rules.teamPassable && p.team > 0 &&
+				owner != p.color && teams[owner] == p.team {
+				hit = false
+			}
+			if next.blocked(pos) || hit || pathCount[pos] > 1 {
+				p.isDead = true
+				p.deathTick = next.tick
+				if hit && owner != p.color {
+					p.killer = owner
+				}
+				break
+			}
+			p.history = append(p.history, pos)
+			if next.rules.trailFade > 0 {
+				p.laid = append(p.laid, next.tick)
+			}
+			new_blocks = append(new_blocks, gui.PlayerBlock{
+				Pos:   pos,
+				Color: p.color,
+				Team:  p.team,
+			})
+			if kind, ok := next.takeItem(pos); ok {
+				picked = kind
+			}
+		}
+		if p.powerUpTicks > 0 {
+			p.powerUpTicks--
+			if p.powerUpTicks == 0 {
+				p.powerUp = ""
+			}
+		}
+		if picked != "" {
+			p.powerUp = picked
+			p.powerUpTicks = powerUpTicks[picked]
+		}
+	}
+	freed := next.decay()
+	next.spawnItem()
+	return next, new_blocks, freed
+}
+
+// isOver tells if the players alive are all on the same side.
+func (s gameState) isOver() bool {
+	return countSides(s.alivePlayers()) <= 1
+}
+
+func (s gameState) alivePlayers() []playerData {
+	alive := make([]playerData, 0, len(s.players))
+	for _, p := range s.players {
+		if !p.isDead {
+			alive = append(alive, p)
+		}
+	}
+	return alive
+}
+
+// step returns the cell next to pos in the given direction, wrapping around
+// the arena if the walls let players through.
+func (s gameState) step(pos gui.Position, dir types.Direction) gui.Position {
+	next := move(pos, dir)
+	if s.rules.walls == WrapWalls {
+		next.X = (next.X + s.size.width) % s.size.width
+		next.Y = (next.Y + s.size.height) % s.size.height
+	}
+	return next
+}
+
+// inset is the number of cells shrinking walls or sudden death have closed
+// in on each side.
+func (s gameState) inset() int {
+	inset := 0
+	if s.rules.walls == ShrinkingWalls && s.rules.shrinkEvery > 0 {
+		inset = s.tick / s.rules.shrinkEvery
+	}
+	if sd := s.suddenDeathInset(); sd > inset {
+		inset = sd
+	}
+	// leave at least two cells in each direction
+	max := s.size.width
+	if s.size.height < max {
+		max = s.size.height
+	}
+	max = (max - 2) / 2
+	if inset > max {
+		return max
+	}
+	return inset
+}
+
+// inArena tells if the cell is inside the walls.
+func (s gameState) inArena(pos gui.Position) bool {
+	i := s.inset()
+	return pos.X >= i && pos.X < s.size.width-i && pos.Y >= i && pos.Y < s.size.height-i
+}
+
+// blocked tells if the cell is outside the walls or on an obstacle.
+func (s gameState) blocked(pos gui.Position) bool {
+	return !s.inArena(pos) || s.rules.obstacles[pos]
+}
+
+func (s gameState) border() gui.Border {
+	return gui.Border{
+		Wrap:      s.rules.walls == WrapWalls,
+		Inset:     s.inset(),
+		Obstacles: s.rules.obstacles,
+	}
+}
+
+// Ticker paces a running game. Games use the wall clock by default, tests
+// inject a ticker they can drive by hand.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+type wallTicker struct {
+	ticker *time.Ticker
+}
+
+func newWallTicker(d time.Duration) Ticker {
+	return &wallTicker{ticker: time.NewTicker(d)}
+}
+
+func (t *wallTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *wallTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+func (t *wallTicker) Stop() {
+	t.ticker.Stop()
+}
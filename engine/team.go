@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTeams is the number of teams players can choose from, team 0 means no
+// team.
+const maxTeams = 4
+
+// side identifies the players fighting together. Players without a team
+// fight alone.
+func (p playerData) side() string {
+	if p.team > 0 {
+		return fmt.Sprintf("team %d", p.team)
+	}
+	return "player " + string(p.color)
+}
+
+// countSides returns the number of different sides of the players.
+func countSides(players []playerData) int {
+	sides := make(map[string]bool)
+	for _, p := range players {
+		sides[p.side()] = true
+	}
+	return len(sides)
+}
+
+// hasTeams tells if any of the players is in a team.
+func hasTeams(players []playerData) bool {
+	for _, p := range players {
+		if p.team > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// winnerName names the side of the players still alive, every member of a
+// winning team is listed. It is empty if everyone is dead.
+func (s gameState) winnerName() string {
+	alive := s.alivePlayers()
+	if len(alive) == 0 {
+		return ""
+	}
+	if alive[0].team == 0 {
+		return alive[0].name
+	}
+	names := make([]string, 0, len(s.players))
+	for _, p := range s.players {
+		if p.team == alive[0].team {
+			names = append(names, p.name)
+		}
+	}
+	return fmt.Sprintf("Team %d (%s)", alive[0].team, strings.Join(names, ", "))
+}
+
+// winnerSide returns the side of the players still alive, it is empty if
+// everyone is dead.
+func (s gameState) winnerSide() string {
+	alive := s.alivePlayers()
+	if len(alive) == 0 {
+		return ""
+	}
+	return alive[0].side()
+}
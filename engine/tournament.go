@@ -0,0 +1,378 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/tron_client/gui"
+	"github.com/tron_client/types"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RoundRobin = "roundrobin"
+	Swiss      = "swiss"
+)
+
+var tournamentColors = [2]types.PlayerColor{"#FF0000", "#0000FF"}
+
+// TournamentSettings configures a bot tournament.
+type TournamentSettings struct {
+	// Bots are the strategies taking part, the same one can appear twice
+	Bots   []string
+	Format string
+	// Rounds is the number of rounds of a Swiss tournament
+	Rounds int
+	// GamesPerPairing is the number of games two bots play when they meet
+	GamesPerPairing int
+	Width           int
+	Height          int
+	Seed            int64
+}
+
+type tournamentGame struct {
+	// index of the bots in the tournament
+	players [2]int
+	// winner is the index of the winner bot, -1 for a draw
+	winner int
+	ticks  int
+	replay *Replay
+}
+
+type TournamentResult struct {
+	names []string
+	// wins[i][j] is the number of games bot i won against bot j
+	wins   [][]int
+	draws  []int
+	losses []int
+	// byes counts the Swiss rounds a bot sat out
+	byes  []int
+	games []tournamentGame
+}
+
+func newTournamentResult(names []string) *TournamentResult {
+	r := &TournamentResult{
+		names:  names,
+		wins:   make([][]int, len(names)),
+		draws:  make([]int, len(names)),
+		losses: make([]int, len(names)),
+		byes:   make([]int, len(names)),
+	}
+	for i := range r.wins {
+		r.wins[i] = make([]int, len(names))
+	}
+	return r
+}
+
+func (r *TournamentResult) add(g tournamentGame) {
+	r.games = append(r.games, g)
+	a, b := g.players[0], g.players[1]
+	switch g.winner {
+	case -1:
+		r.draws[a]++
+		r.draws[b]++
+	case a:
+		r.wins[a][b]++
+		r.losses[b]++
+	case b:
+		r.wins[b][a]++
+		r.losses[a]++
+	}
+}
+
+func (r *TournamentResult) totalWins(i int) int {
+	total := 0
+	for _, w := range r.wins[i] {
+		total += w
+	}
+	return total
+}
+
+// points gives 3 points for a win and 1 for a draw.
+func (r *TournamentResult) points(i int) int {
+	return 3*r.totalWins(i) + r.draws[i]
+}
+
+// ranking returns the bot indexes ordered by points, then wins.
+func (r *TournamentResult) ranking() []int {
+	order := make([]int, len(r.names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if r.points(a) != r.points(b) {
+			return r.points(a) > r.points(b)
+		}
+		return r.totalWins(a) > r.totalWins(b)
+	})
+	return order
+}
+
+func (r *TournamentResult) Standings() []string {
+	lines := make([]string, 0, len(r.names))
+	for rank, i := range r.ranking() {
+		lines = append(lines, fmt.Sprintf("%d. %s: %d points, %d wins, %d draws, %d losses",
+			rank+1, r.names[i], r.points(i), r.totalWins(i), r.draws[i], r.losses[i]))
+	}
+	return lines
+}
+
+// WinMatrix shows how many games the bot of the row won against the bot of
+// the column.
+func (r *TournamentResult) WinMatrix() []string {
+	width := 0
+	for _, n := range r.names {
+		if len(n) > width {
+			width = len(n)
+		}
+	}
+	var sb strings.Builder
+	lines := make([]string, 0, len(r.names)+1)
+	// room for the row number and the name
+	sb.WriteString(strings.Repeat(" ", width+3))
+	for j := range r.names {
+		sb.WriteString(fmt.Sprintf(" %4d", j+1))
+	}
+	lines = append(lines, sb.String())
+	for i, n := range r.names {
+		sb.Reset()
+		sb.WriteString(fmt.Sprintf("%2d %-*s", i+1, width, n))
+		for j := range r.names {
+			if i == j {
+				sb.WriteString("    -")
+			} else {
+				sb.WriteString(fmt.Sprintf(" %4d", r.wins[i][j]))
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+// notableGames are the longest game and the upsets, where the winner ended
+// up lower in the standings than the loser.
+func (r *TournamentResult) notableGames() map[string]tournamentGame {
+	notable := make(map[string]tournamentGame)
+	rank := make([]int, len(r.names))
+	for pos, i := range r.ranking() {
+		rank[i] = pos
+	}
+	longest := -1
+	for n, g := range r.games {
+		if longest < 0 || g.ticks > r.games[longest].ticks {
+			longest = n
+		}
+		loser := g.players[0]
+		if loser == g.winner {
+			loser = g.players[1]
+		}
+		if g.winner >= 0 && rank[g.winner] > rank[loser] {
+			notable[fmt.Sprintf("upset_%d_%s_beats_%s", n+1, r.names[g.winner],
+				r.names[loser])] = g
+		}
+	}
+	if longest >= 0 {
+		notable[fmt.Sprintf("longest_%d", longest+1)] = r.games[longest]
+	}
+	return notable
+}
+
+// SaveReplays writes the replays of the notable games into the directory and
+// returns the file names.
+func (r *TournamentResult) SaveReplays(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for name, g := range r.notableGames() {
+		// strategies of external bots may contain path separators
+		name = strings.Map(func(c rune) rune {
+			if strings.ContainsRune(`/\: `, c) {
+				return '_'
+			}
+			return c
+		}, name)
+		path := filepath.Join(dir, name+".json")
+		if err := g.replay.Save(path); err != nil {
+			return files, err
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// RunTournament plays the bots against each other as fast as possible.
+func RunTournament(s TournamentSettings) (*TournamentResult, error) {
+	if len(s.Bots) < 2 {
+		return nil, fmt.Errorf("At least 2 bots are needed for a tournament")
+	}
+	if s.Width < minArenaSize || s.Height < minArenaSize {
+		return nil, fmt.Errorf("Arena should be at least %dx%d", minArenaSize, minArenaSize)
+	}
+	names := make([]string, len(s.Bots))
+	for i, strategy := range s.Bots {
+		// validate the strategies before playing
+		if _, err := NewBot(strategy, Hard, 0); err != nil {
+			return nil, err
+		}
+		names[i] = fmt.Sprintf("%s#%d", strategy, i+1)
+	}
+	r := newTournamentResult(names)
+	rnd := rand.New(rand.NewSource(s.Seed))
+
+	var pairings func(round int) [][2]int
+	rounds := 1
+	switch s.Format {
+	case RoundRobin:
+		pairings = func(int) [][2]int { return roundRobinPairings(len(s.Bots)) }
+	case Swiss:
+		pairings = func(int) [][2]int { return swissPairings(r) }
+		rounds = s.Rounds
+	default:
+		return nil, fmt.Errorf("Unknown tournament format: '%s'", s.Format)
+	}
+
+	for round := 0; round < rounds; round++ {
+		for _, pair := range pairings(round) {
+			for n := 0; n < s.GamesPerPairing; n++ {
+				// swap sides every other game
+				sides := pair
+				if n%2 == 1 {
+					sides = [2]int{pair[1], pair[0]}
+				}
+				g, err := playBotGame(s, sides, rnd)
+				if err != nil {
+					return r, err
+				}
+				r.add(g)
+			}
+		}
+	}
+	return r, nil
+}
+
+func roundRobinPairings(n int) [][2]int {
+	pairs := make([][2]int, 0, n*(n-1)/2)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			pairs = append(pairs, [2]int{i, j})
+		}
+	}
+	return pairs
+}
+
+// swissPairings pairs bots with similar scores that have not met yet. With
+// an odd number of bots the lowest ranked one that sat out the fewest rounds
+// sits out the round, without getting points.
+func swissPairings(r *TournamentResult) [][2]int {
+	met := func(a, b int) bool {
+		for _, g := range r.games {
+			if (g.players[0] == a && g.players[1] == b) || (g.players[0] == b && g.players[1] == a) {
+				return true
+			}
+		}
+		return false
+	}
+	free := r.ranking()
+	if len(free)%2 == 1 {
+		bye := len(free) - 1
+		for i := len(free) - 1; i >= 0; i-- {
+			if r.byes[free[i]] < r.byes[free[bye]] {
+				bye = i
+			}
+		}
+		r.byes[free[bye]]++
+		free = append(free[:bye], free[bye+1:]...)
+	}
+	pairs := make([][2]int, 0, len(free)/2)
+	for len(free) > 1 {
+		a := free[0]
+		opponent := 1
+		for i := 1; i < len(free); i++ {
+			if !met(a, free[i]) {
+				opponent = i
+				break
+			}
+		}
+		pairs = append(pairs, [2]int{a, free[opponent]})
+		free = append(free[1:opponent], free[opponent+1:]...)
+	}
+	return pairs
+}
+
+// playBotGame plays a single game on a headless GUI using random start
+// positions.
+func playBotGame(s TournamentSettings, pair [2]int, rnd *rand.Rand) (tournamentGame, error) {
+	players := randomStarts(Size{width: s.Width, height: s.Height}, rnd)
+	bots := make([]Bot, len(pair))
+	defer closeBots(bots)
+	for i, b := range pair {
+		players[i].name = s.Bots[b]
+		bot, err := NewBot(s.Bots[b], Hard, rnd.Int63())
+		if err != nil {
+			return tournamentGame{}, err
+		}
+		bots[i] = bot
+	}
+
+	game := newGame(s.Width, s.Height, players, types.Headless)
+	game.replay = NewReplay(game.state)
+	for i, p := range game.state.players {
+		startBot(bots[i], newGameView(game.state, p.color))
+	}
+	over := false
+	for !over {
+		in := make(inputs)
+		for i, p := range game.state.players {
+			if !p.isDead {
+				in[p.color] = input{dir: bots[i].Decide(newGameView(game.state, p.color))}
+			}
+		}
+		over = game.Step(in)
+	}
+	game.gameGui.Close()
+
+	g := tournamentGame{
+		players: pair,
+		winner:  -1,
+		ticks:   game.state.tick,
+		replay:  game.replay,
+	}
+	for i, p := range game.state.players {
+		if !p.isDead {
+			g.winner = pair[i]
+		}
+	}
+	return g, nil
+}
+
+// randomStarts places two players on random cells away from the walls,
+// heading in random directions.
+func randomStarts(size Size, rnd *rand.Rand) []playerData {
+	const margin = 2
+	players := make([]playerData, len(tournamentColors))
+	taken := make(map[gui.Position]bool)
+	for i := range players {
+		var pos gui.Position
+		for {
+			pos = gui.Position{
+				X: margin + rnd.Intn(size.width-2*margin),
+				Y: margin + rnd.Intn(size.height-2*margin),
+			}
+			if !taken[pos] {
+				break
+			}
+		}
+		taken[pos] = true
+		players[i] = playerData{
+			history: []gui.Position{pos},
+			color:   tournamentColors[i],
+			dir:     allDirections[rnd.Intn(len(allDirections))],
+		}
+	}
+	return players
+}
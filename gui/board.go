@@ -0,0 +1,169 @@
+package gui
+
+import (
+	"fmt"
+	"github.com/tron_client/types"
+)
+
+// board is the model of the arena shared by the game GUIs, they draw it with
+// their own means.
+type board struct {
+	width   int
+	height  int
+	cells   [][]Cell
+	heads   map[types.PlayerColor]Position
+	border  Border
+	status  string
+	overlay []string
+	legend  []LegendEntry
+	// tokens of the players are kept between resets
+	tokens      map[types.PlayerColor]byte
+	token_index int
+}
+
+func newBoard(width int, height int) *board {
+	b := &board{
+		width:  width,
+		height: height,
+		tokens: make(map[types.PlayerColor]byte),
+	}
+	b.reset()
+	return b
+}
+
+func (b *board) reset() {
+	b.cells = make([][]Cell, b.height)
+	for y := range b.cells {
+		b.cells[y] = make([]Cell, b.width)
+	}
+	b.heads = make(map[types.PlayerColor]Position)
+	b.status = ""
+	b.overlay = nil
+}
+
+func (b *board) inside(pos Position) bool {
+	return pos.X >= 0 && pos.X < b.width && pos.Y >= 0 && pos.Y < b.height
+}
+
+func (b *board) setCell(pos Position, c Cell) error {
+	if !b.inside(pos) {
+		return fmt.Errorf("Cell out of board: %d, %d", pos.X, pos.Y)
+	}
+	if c.Color != "" {
+		if _, err := b.token(c.Color, c.Team); err != nil {
+			return err
+		}
+	}
+	b.cells[pos.Y][pos.X] = c
+	return nil
+}
+
+// token returns the token of the player, a new one is assigned to players
+// not seen before.
+func (b *board) token(color types.PlayerColor, team int) (byte, error) {
+	if token, ok := b.tokens[color]; ok {
+		return token, nil
+	}
+	if token, ok := teamToken(team); ok {
+		b.tokens[color] = token
+	} else if b.token_index < len(player_tokens) {
+		b.tokens[color] = player_tokens[b.token_index]
+		b.token_index++
+	} else {
+		return 0, fmt.Errorf("Running out of player tokens")
+	}
+	return b.tokens[color], nil
+}
+
+// setLegend assigns the tokens of the players in the order of the entries.
+func (b *board) setLegend(entries []LegendEntry) error {
+	b.legend = append([]LegendEntry(nil), entries...)
+	for _, e := range entries {
+		if _, err := b.token(e.Color, e.Team); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legendLines returns the lines of the legend: the token and the name of the
+// players.
+func (b *board) legendLines() []string {
+	lines := make([]string, len(b.legend))
+	for i, e := range b.legend {
+		lines[i] = fmt.Sprintf("%c %s", b.tokens[e.Color], e.Name)
+	}
+	return lines
+}
+
+func (b *board) clearCell(pos Position) {
+	if b.inside(pos) {
+		b.cells[pos.Y][pos.X] = Cell{}
+	}
+}
+
+// glyph returns the character drawn at the cell, using empty for empty cells.
+// Head markers and the overlay are left to the GUIs.
+func (b *board) glyph(x int, y int, empty byte) byte {
+	if b.border.Closed(x, y, b.width, b.height) {
+		return '#'
+	}
+	c := b.cells[y][x]
+	if c.Color != "" {
+		return b.tokens[c.Color]
+	}
+	if c.Glyph != 0 {
+		return c.Glyph
+	}
+	return empty
+}
+
+// isHead tells if the head marker of a player is on the cell.
+func (b *board) isHead(pos Position) bool {
+	c := b.cells[pos.Y][pos.X]
+	head, ok := b.heads[c.Color]
+	return ok && c.Color != "" && head == pos
+}
+
+// overlayRect returns the top left corner and the size of the overlay,
+// centered on the board and clipped to it.
+func (b *board) overlayRect() (x int, y int, w int, h int) {
+	for _, line := range b.overlay {
+		if len(line) > w {
+			w = len(line)
+		}
+	}
+	// one cell of padding on each side
+	w, h = w+2, len(b.overlay)+2
+	if w > b.width {
+		w = b.width
+	}
+	if h > b.height {
+		h = b.height
+	}
+	return (b.width - w) / 2, (b.height - h) / 2, w, h
+}
+
+// overlayAt returns the character of the overlay covering the cell, if any.
+func (b *board) overlayAt(x int, y int) (byte, bool) {
+	if len(b.overlay) == 0 {
+		return 0, false
+	}
+	ox, oy, w, h := b.overlayRect()
+	if x < ox || x >= ox+w || y < oy || y >= oy+h {
+		return 0, false
+	}
+	row, col := y-oy-1, x-ox-1
+	if row < 0 || row >= len(b.overlay) || col < 0 || col >= len(b.overlay[row]) {
+		return ' ', true
+	}
+	return b.overlay[row][col], true
+}
+
+// teamToken returns the token shared by the members of a team.
+func teamToken(team int) (byte, bool) {
+	if team < 1 || team > len(team_tokens) {
+		return 0, false
+	}
+	return team_tokens[team-1], true
+}
@@ -1,14 +1,46 @@
 package gui
 
 import (
+	"fmt"
 	gc "github.com/rthornton128/goncurses"
+	"github.com/tron_client/types"
 	"log"
+	"strings"
+	"sync"
+)
+
+// errors are highlighted in red
+const error_color types.PlayerColor = "#FF0000"
+
+// width of the player list next to the chat, it is left out if the terminal
+// is narrower than min_panel_cols
+const (
+	panel_width    = 26
+	min_panel_cols = 60
 )
 
 type NCurse struct {
 	scr       *gc.Window
 	outputWin *gc.Window
 	inputWin  *gc.Window
+	panelWin  *gc.Window
+	statusWin *gc.Window
+	palette   *palette
+	input     *lineEditor
+
+	// the history is drawn from the listener of the server too
+	lock      sync.Mutex
+	history   []ChatEntry
+	showTimes bool
+	search    string
+	// scroll is the number of lines scrolled back from the bottom, unseen is
+	// set if messages arrived meanwhile
+	scroll int
+	unseen bool
+
+	players   []types.LobbyPlayer
+	status    LobbyStatus
+	showPanel bool
 }
 
 func NewNCurse() *NCurse {
@@ -17,82 +49,422 @@ func NewNCurse() *NCurse {
 	if err != nil {
 		log.Fatal("Init screen:", err)
 	}
-	rows, cols := screen.MaxYX()
-	outwin, err := gc.NewWindow(rows-3, cols-2, 0, 0)
+	// the input line is drawn by FetchOne
+	gc.Echo(false)
+	// the windows get their size from fitWindows
+	outwin, err := gc.NewWindow(1, 1, 0, 0)
 	if err != nil {
 		log.Fatal("Init output window:", err)
 	}
-	inwin, err := gc.NewWindow(3, cols-2, rows-3, 0)
+	inwin, err := gc.NewWindow(1, 1, 0, 0)
 	if err != nil {
 		log.Fatal("Init input window:", err)
 	}
+	// report page and arrow keys with their own key codes
+	inwin.Keypad(true)
+	panelwin, err := gc.NewWindow(1, 1, 0, 0)
+	if err != nil {
+		log.Fatal("Init player list window:", err)
+	}
+	statuswin, err := gc.NewWindow(1, 1, 0, 0)
+	if err != nil {
+		log.Fatal("Init status window:", err)
+	}
 	n := &NCurse{
 		outputWin: outwin,
 		inputWin:  inwin,
+		panelWin:  panelwin,
+		statusWin: statuswin,
 		scr:       screen,
+		palette:   newPalette(),
+		input:     newLineEditor(),
 	}
+	n.fitWindows()
 
 	return n
 }
 
-func (n *NCurse) clearInput() {
+// fitWindows lays the windows out in the terminal: the chat with the player
+// list on its right, the input line and the status bar under them. It returns
+// false if the terminal is too small.
+func (n *NCurse) fitWindows() bool {
+	rows, cols := n.scr.MaxYX()
+	// room for at least one line of history, the input line and the status
+	if rows < 7 || cols < 10 {
+		log.Printf("Terminal too small: %dx%d", cols, rows)
+		return false
+	}
+	chat_cols := cols - 2
+	n.showPanel = cols >= min_panel_cols
+	if n.showPanel {
+		chat_cols -= panel_width
+		n.panelWin.Resize(rows-4, panel_width)
+		n.panelWin.MoveWindow(0, chat_cols)
+	}
+	n.outputWin.Resize(rows-4, chat_cols)
+	n.inputWin.Resize(3, cols-2)
+	n.inputWin.MoveWindow(rows-4, 0)
+	n.statusWin.Resize(1, cols-2)
+	n.statusWin.MoveWindow(rows-1, 0)
+	return true
+}
+
+func (n *NCurse) drawInput() {
+	_, width := n.inputWin.MaxYX()
+	// borders, prompt and room for the cursor after the line
+	line, cursor := n.input.visible(width - 5)
 	n.inputWin.Erase()
 	n.inputWin.Move(1, 1)
 	n.inputWin.Box(gc.ACS_VLINE, gc.ACS_HLINE)
-	n.inputWin.Print("> ")
+	n.inputWin.Print("> " + line)
+	n.inputWin.Move(1, 3+cursor)
 	n.inputWin.NoutRefresh()
 }
 
 // ChatGui methods
 // -----------------------------------
 
-func (n *NCurse) SetChatHistory(msgs []string) {
-	n.outputWin.Erase()
+func (n *NCurse) SetChatHistory(msgs []ChatEntry) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	// keep the view in place if it is scrolled back
+	if n.scroll > 0 && len(msgs) > len(n.history) {
+		before := len(n.layout())
+		n.history = msgs
+		n.scroll += len(n.layout()) - before
+		n.unseen = true
+	} else {
+		n.history = msgs
+	}
+	n.draw()
+}
+
+func (n *NCurse) ShowTimestamps(show bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.showTimes = show
+	// the lines may wrap differently with or without the time
+	n.clampScroll(len(n.layout()))
+	n.draw()
+}
+
+// Search highlights the text in the history and scrolls back to the last
+// match. An empty text clears the highlight.
+func (n *NCurse) Search(text string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.search = text
+	lines := n.layout()
+	rows := n.rows()
+	for i := len(lines) - 1; i >= 0 && text != ""; i-- {
+		if !n.format(lines[i].entry).matchStarts(lines[i].start, lines[i].end) {
+			continue
+		}
+		// show the match in the middle of the window if it is out of view
+		if first := len(lines) - rows - n.scroll; i < first || i >= first+rows {
+			n.scroll = len(lines) - rows - (i - rows/2)
+			n.clampScroll(len(lines))
+		}
+		break
+	}
+	n.draw()
+}
+
+// scrollBy scrolls back by the number of lines, negative lines scroll
+// forward.
+func (n *NCurse) scrollBy(lines int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.scroll += lines
+	n.clampScroll(len(n.layout()))
+	n.draw()
+}
+
+func (n *NCurse) clampScroll(total int) {
+	n.scroll = clampedScroll(n.scroll, total, n.rows())
+	if n.scroll == 0 {
+		n.unseen = false
+	}
+}
 
-	// get number of available columns
+// rows returns the number of lines of history shown.
+func (n *NCurse) rows() int {
 	h, _ := n.outputWin.MaxYX()
-	max_cols := h - 2
-	start_index := 0
-	if overflow := len(msgs) - max_cols; overflow > 0 {
-		start_index = overflow
+	return h - 2
+}
+
+func (n *NCurse) format(i int) formattedEntry {
+	return formatEntry(n.history[i], n.showTimes, n.search)
+}
+
+func (n *NCurse) layout() []chatLine {
+	_, w := n.outputWin.MaxYX()
+	entries := make([]formattedEntry, len(n.history))
+	for i := range n.history {
+		entries[i] = n.format(i)
 	}
+	return layoutChat(entries, w-2)
+}
 
-	_ = start_index
-	for i, v := range msgs[start_index:] {
-		n.outputWin.Move(i+1, 1)
-		n.outputWin.Println(v)
+func (n *NCurse) draw() {
+	n.outputWin.Erase()
+	lines := n.layout()
+	rows := n.rows()
+	first := len(lines) - rows - n.scroll
+	if first < 0 {
+		first = 0
+	}
+	for i := first; i < len(lines) && i < first+rows; i++ {
+		n.outputWin.Move(i-first+1, 1)
+		n.printLine(lines[i])
 	}
 	n.outputWin.Box(gc.ACS_VLINE, gc.ACS_HLINE)
+	if n.scroll > 0 {
+		n.outputWin.Move(rows+1, 2)
+		if n.unseen {
+			n.outputWin.Print(" new messages below, PgDn ")
+		} else {
+			n.outputWin.Print(" more below, PgDn ")
+		}
+	}
 	n.outputWin.NoutRefresh()
 	gc.Update()
 }
 
+// printLine prints the line at the cursor: the name of players in their
+// color, system messages dimmed, errors and search matches highlighted.
+func (n *NCurse) printLine(l chatLine) {
+	e := n.history[l.entry]
+	f := n.format(l.entry)
+	attrAt := func(i int) gc.Char {
+		var attr gc.Char
+		switch {
+		case i < f.timeEnd:
+			attr = gc.A_DIM
+		case e.Kind == ChatMessage && i >= f.nameStart && i < f.nameEnd:
+			attr = n.palette.attr(e.Color) | gc.A_BOLD
+		case e.Kind == SystemMessage:
+			attr = gc.A_DIM
+		case e.Kind == ErrorMessage:
+			attr = n.palette.attr(error_color) | gc.A_BOLD
+		}
+		if f.inMatch(i) {
+			attr |= gc.A_REVERSE
+		}
+		return attr
+	}
+	// print runs of the same attribute
+	for start := l.start; start < l.end; {
+		attr := attrAt(start)
+		end := start + 1
+		for end < l.end && attrAt(end) == attr {
+			end++
+		}
+		n.outputWin.AttrOn(attr)
+		n.outputWin.Print(f.text[start:end])
+		n.outputWin.AttrOff(attr)
+		start = end
+	}
+}
+
+// SetPlayers shows the players in the list next to the chat.
+func (n *NCurse) SetPlayers(players []types.LobbyPlayer) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.players = append([]types.LobbyPlayer(nil), players...)
+	n.drawPanel()
+}
+
+func (n *NCurse) SetStatus(status LobbyStatus) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.status = status
+	n.drawStatus()
+}
+
+// drawPanel draws the player list: the name in the color of the player with
+// the ready state, then the team, role and ping if known.
+func (n *NCurse) drawPanel() {
+	if !n.showPanel {
+		return
+	}
+	h, w := n.panelWin.MaxYX()
+	n.panelWin.Erase()
+	n.panelWin.Box(gc.ACS_VLINE, gc.ACS_HLINE)
+	n.panelWin.Move(0, 2)
+	n.panelWin.Printf(" Players (%d) ", len(n.players))
+	row := 1
+	for _, p := range n.players {
+		if row >= h-1 {
+			break
+		}
+		ready := "[ ]"
+		if p.Ready {
+			ready = "[x]"
+		}
+		name := p.Name
+		if len(name) > w-6 {
+			name = name[:w-6]
+		}
+		n.panelWin.Move(row, 1)
+		n.panelWin.Print(ready + " ")
+		attr := n.palette.attr(p.Color) | gc.A_BOLD
+		n.panelWin.AttrOn(attr)
+		n.panelWin.Print(name)
+		n.panelWin.AttrOff(attr)
+		row++
+
+		details := playerDetails(p)
+		if details == "" || row >= h-1 {
+			continue
+		}
+		if len(details) > w-6 {
+			details = details[:w-6]
+		}
+		n.panelWin.Move(row, 5)
+		n.panelWin.AttrOn(gc.A_DIM)
+		n.panelWin.Print(details)
+		n.panelWin.AttrOff(gc.A_DIM)
+		row++
+	}
+	n.panelWin.NoutRefresh()
+	gc.Update()
+}
+
+func playerDetails(p types.LobbyPlayer) string {
+	var details []string
+	if p.Team > 0 {
+		details = append(details, fmt.Sprintf("team %d", p.Team))
+	}
+	if p.Role != "" {
+		details = append(details, p.Role)
+	}
+	if p.Ping > 0 {
+		details = append(details, fmt.Sprintf("%d ms", p.Ping))
+	}
+	return strings.Join(details, ", ")
+}
+
+func (n *NCurse) drawStatus() {
+	_, w := n.statusWin.MaxYX()
+	line := n.status.State
+	if n.status.Server != "" {
+		line += " | server: " + n.status.Server
+	}
+	if n.status.Room != "" {
+		line += " | room: " + n.status.Room
+	}
+	if len(line) > w {
+		line = line[:w]
+	}
+	n.statusWin.Erase()
+	n.statusWin.AttrOn(gc.A_REVERSE)
+	n.statusWin.Move(0, 0)
+	n.statusWin.Print(line + strings.Repeat(" ", w-len(line)))
+	n.statusWin.AttrOff(gc.A_REVERSE)
+	n.statusWin.NoutRefresh()
+	gc.Update()
+}
+
 func (n *NCurse) Close() {
+	n.statusWin.Delete()
+	n.panelWin.Delete()
 	n.outputWin.Delete()
 	n.inputWin.Delete()
 	gc.End()
 }
 
+// resize fits the windows in the resized terminal and draws the history
+// again, wrapped to the new width.
+func (n *NCurse) resize() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if !n.fitWindows() {
+		return
+	}
+	n.scr.Erase()
+	n.scr.NoutRefresh()
+	n.clampScroll(len(n.layout()))
+	n.draw()
+	n.drawPanel()
+	n.drawStatus()
+}
+
+// control keys of the line editor
+const (
+	key_ctrl_a = 1
+	key_ctrl_e = 5
+	key_ctrl_w = 23
+	key_tab    = 9
+)
+
+// FetchOne reads a line of input. The line can be edited, Up and Down go
+// through the history of the lines sent, Tab completes the word before the
+// cursor. Page keys scroll through the history of the chat meanwhile,
+// resizing the terminal is reported by ncurses as a key too.
 func (n *NCurse) FetchOne() (string, error) {
 	for {
-		n.clearInput()
+		n.drawInput()
 		gc.Update()
-		_, width := n.inputWin.MaxYX()
-		inp, err := n.inputWin.GetString(width - 6)
-		if err != nil {
-			return "", err
+		key := n.inputWin.GetChar()
+		if key != key_tab {
+			n.input.resetCompletion()
 		}
-		if len(inp) < 1 {
-			continue
+		switch key {
+		case gc.KEY_RESIZE:
+			n.resize()
+		case gc.KEY_PAGEUP:
+			n.scrollBy(n.rows() - 1)
+		case gc.KEY_PAGEDOWN:
+			n.scrollBy(1 - n.rows())
+		case gc.KEY_LEFT:
+			n.input.left()
+		case gc.KEY_RIGHT:
+			n.input.right()
+		case gc.KEY_HOME, key_ctrl_a:
+			n.input.home()
+		case gc.KEY_END, key_ctrl_e:
+			n.input.end()
+		case gc.KEY_UP:
+			n.input.prev()
+		case gc.KEY_DOWN:
+			n.input.next()
+		case key_ctrl_w:
+			n.input.deleteWord()
+		case key_tab:
+			n.input.complete()
+		case gc.KEY_BACKSPACE, 127, 8:
+			n.input.backspace()
+		case gc.KEY_DC:
+			n.input.delete()
+		case gc.KEY_ENTER, '\n', '\r':
+			if strings.TrimSpace(n.input.String()) == "" {
+				continue
+			}
+			line := n.input.submit()
+			n.drawInput()
+			return line, nil
+		default:
+			if key >= ' ' && key < 127 {
+				n.input.insert(rune(key))
+			}
 		}
-		n.clearInput()
-		return inp, nil
 	}
 }
 
+func (n *NCurse) SetCompleter(c Completer) {
+	n.input.completer = c
+}
+
+// HeadlessChat reads the input from the Input channel and keeps the player
+// list and the status in memory.
 type HeadlessChat struct {
 	Input chan string
 
+	lock    sync.Mutex
+	players []types.LobbyPlayer
+	status  LobbyStatus
+
 	stop chan bool
 }
 
@@ -116,4 +488,36 @@ func (g *HeadlessChat) Close() {
 	g.stop <- true
 }
 
-func (n *HeadlessChat) SetChatHistory(msgs []string) {}
+func (n *HeadlessChat) SetChatHistory(msgs []ChatEntry) {}
+
+func (n *HeadlessChat) ShowTimestamps(show bool) {}
+
+func (n *HeadlessChat) Search(text string) {}
+
+func (n *HeadlessChat) SetCompleter(c Completer) {}
+
+func (n *HeadlessChat) SetPlayers(players []types.LobbyPlayer) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.players = append([]types.LobbyPlayer(nil), players...)
+}
+
+func (n *HeadlessChat) SetStatus(status LobbyStatus) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.status = status
+}
+
+// Players returns the last player list shown.
+func (n *HeadlessChat) Players() []types.LobbyPlayer {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.players
+}
+
+// Status returns the last status shown.
+func (n *HeadlessChat) Status() LobbyStatus {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.status
+}
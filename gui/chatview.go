@@ -0,0 +1,129 @@
+package gui
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// chatLine is a line of the chat window, a part of a formatted entry.
+type chatLine struct {
+	entry int
+	// byte range of the line in the formatted entry
+	start int
+	end   int
+}
+
+// formattedEntry is an entry as shown in the chat window.
+type formattedEntry struct {
+	text string
+	// byte ranges of the timestamp and the sender of chat messages
+	timeEnd   int
+	nameStart int
+	nameEnd   int
+	// byte ranges of the search matches
+	matches [][2]int
+}
+
+func formatEntry(e ChatEntry, showTimes bool, search string) formattedEntry {
+	f := formattedEntry{}
+	if showTimes {
+		f.text = e.Time.Format("15:04 ")
+		f.timeEnd = len(f.text)
+	}
+	f.nameStart = len(f.text)
+	f.text += e.Sender
+	f.nameEnd = len(f.text)
+	f.text += ": " + e.Text
+	if search != "" {
+		f.matches = findAll(f.text[f.timeEnd:], search)
+		for i := range f.matches {
+			f.matches[i][0] += f.timeEnd
+			f.matches[i][1] += f.timeEnd
+		}
+	}
+	return f
+}
+
+// inMatch tells if the byte of the formatted entry is part of a search match.
+func (f formattedEntry) inMatch(i int) bool {
+	for _, m := range f.matches {
+		if i >= m[0] && i < m[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchStarts tells if a search match starts in the byte range.
+func (f formattedEntry) matchStarts(start int, end int) bool {
+	for _, m := range f.matches {
+		if m[0] >= start && m[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// findAll returns the byte ranges of the text matching the query, ignoring
+// case. Matches start at the first byte of a character.
+func findAll(text string, query string) [][2]int {
+	var found [][2]int
+	for i := 0; query != "" && i+len(query) <= len(text); {
+		if strings.EqualFold(text[i:i+len(query)], query) {
+			found = append(found, [2]int{i, i + len(query)})
+			i += len(query)
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return found
+}
+
+// wrapText splits the text into lines not longer than width characters,
+// breaking at spaces if possible. It returns the byte ranges of the lines.
+func wrapText(s string, width int) [][2]int {
+	var lines [][2]int
+	start := 0
+	for width > 0 && utf8.RuneCountInString(s[start:]) > width {
+		end := start
+		for i := 0; i < width; i++ {
+			_, size := utf8.DecodeRuneInString(s[end:])
+			end += size
+		}
+		// a space right after the line can be dropped too
+		cut := strings.LastIndexByte(s[start:end+1], ' ')
+		if cut <= 0 {
+			// no space to break at, the word is cut
+			lines = append(lines, [2]int{start, end})
+			start = end
+		} else {
+			lines = append(lines, [2]int{start, start + cut})
+			start += cut + 1
+		}
+	}
+	return append(lines, [2]int{start, len(s)})
+}
+
+// clampedScroll keeps the number of lines scrolled back between showing the
+// first and the last line of the history.
+func clampedScroll(scroll int, total int, rows int) int {
+	if scroll > total-rows {
+		scroll = total - rows
+	}
+	if scroll < 0 {
+		scroll = 0
+	}
+	return scroll
+}
+
+// layoutChat wraps the entries to the width of the window.
+func layoutChat(entries []formattedEntry, width int) []chatLine {
+	lines := make([]chatLine, 0, len(entries))
+	for i, f := range entries {
+		for _, r := range wrapText(f.text, width) {
+			lines = append(lines, chatLine{entry: i, start: r[0], end: r[1]})
+		}
+	}
+	return lines
+}
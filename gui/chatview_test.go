@@ -0,0 +1,91 @@
+package gui
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWrapText(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		text  string
+		width int
+		lines []string
+	}{
+		{"", 10, []string{""}},
+		{"short", 10, []string{"short"}},
+		{"exactly10!", 10, []string{"exactly10!"}},
+		{"hello world", 5, []string{"hello", "world"}},
+		{"hello world again", 11, []string{"hello world", "again"}},
+		{"a verylongword", 5, []string{"a", "veryl", "ongwo", "rd"}},
+		{"unlimited width", 0, []string{"unlimited width"}},
+		// characters are counted, not bytes
+		{"árvíztűrő tükörfúrógép", 9, []string{"árvíztűrő", "tükörfúró", "gép"}},
+		{"ééééé", 2, []string{"éé", "éé", "é"}},
+	}
+	for _, test := range tests {
+		var lines []string
+		for _, r := range wrapText(test.text, test.width) {
+			lines = append(lines, test.text[r[0]:r[1]])
+		}
+		assert.Equal(test.lines, lines, test.text)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		text  string
+		query string
+		found [][2]int
+	}{
+		{"hello", "", nil},
+		{"hello", "x", nil},
+		{"Hello hello", "hello", [][2]int{{0, 5}, {6, 11}}},
+		{"aaaa", "aa", [][2]int{{0, 2}, {2, 4}}},
+		{"Ágnes ágnes", "ágnes", [][2]int{{0, 6}, {7, 13}}},
+	}
+	for _, test := range tests {
+		assert.Equal(test.found, findAll(test.text, test.query), test.text)
+	}
+}
+
+func TestLayoutChat(t *testing.T) {
+	assert := assert.New(t)
+	at := time.Date(2024, 1, 1, 12, 34, 0, 0, time.UTC)
+	entries := []formattedEntry{
+		formatEntry(ChatEntry{Sender: "Kek", Text: "hi", Time: at}, true, ""),
+		formatEntry(ChatEntry{Sender: "Zold", Text: "hello there", Time: at}, false, "there"),
+	}
+	assert.Equal("12:34 Kek: hi", entries[0].text)
+	assert.Equal(6, entries[0].timeEnd)
+	assert.Equal([][2]int{{12, 17}}, entries[1].matches)
+	assert.True(entries[1].matchStarts(12, 17))
+	assert.False(entries[1].matchStarts(0, 12))
+
+	lines := layoutChat(entries, 12)
+	assert.Equal([]chatLine{
+		{entry: 0, start: 0, end: 10},
+		{entry: 0, start: 11, end: 13},
+		{entry: 1, start: 0, end: 11},
+		{entry: 1, start: 12, end: 17},
+	}, lines)
+}
+
+func TestClampedScroll(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		scroll, total, rows, clamped int
+	}{
+		{0, 5, 10, 0},
+		{3, 5, 10, 0},
+		{3, 20, 10, 3},
+		{15, 20, 10, 10},
+		{-2, 20, 10, 0},
+		{1, 10, 10, 0},
+	}
+	for _, test := range tests {
+		assert.Equal(test.clamped, clampedScroll(test.scroll, test.total, test.rows), test)
+	}
+}
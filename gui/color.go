@@ -0,0 +1,192 @@
+package gui
+
+import (
+	gc "github.com/rthornton128/goncurses"
+	"github.com/tron_client/types"
+	"log"
+	"os"
+	"strconv"
+)
+
+// colorMode is what the terminal can do with colors.
+type colorMode int
+
+const (
+	// monochrome terminals tell players apart by their tokens only
+	monochrome colorMode = iota
+	// basicColors are the 8 colors of curses
+	basicColors
+	// xtermColors are the 256 colors of xterm
+	xtermColors
+	// trueColors are drawn exactly by redefining the colors of the terminal
+	trueColors
+)
+
+// first color redefined in truecolor mode, the basic ones are kept
+const first_color_slot = 16
+
+// sum of the components of the darkest color drawn as is
+const min_brightness = 96
+
+// levels of the red, green and blue components in the xterm color cube
+var cube_levels = [...]int{0, 95, 135, 175, 215, 255}
+
+// palette maps the colors of the players to color pairs of the terminal.
+type palette struct {
+	mode  colorMode
+	pairs map[types.PlayerColor]int16
+	// next free color pair and color slot
+	next_pair int16
+	next_slot int16
+}
+
+// newPalette starts colors if the terminal has them. Setting NO_COLOR in the
+// environment forces the monochrome mode.
+func newPalette() *palette {
+	p := &palette{
+		pairs:     make(map[types.PlayerColor]int16),
+		next_pair: 1,
+		next_slot: first_color_slot,
+	}
+	if os.Getenv("NO_COLOR") != "" || !gc.HasColors() {
+		log.Print("Terminal without colors")
+		return p
+	}
+	if err := gc.StartColor(); err != nil {
+		log.Printf("Unable to start colors: %s", err.Error())
+		return p
+	}
+	switch {
+	case gc.CanChangeColor() && gc.Colors() >= 256:
+		p.mode = trueColors
+	case gc.Colors() >= 256:
+		p.mode = xtermColors
+	default:
+		p.mode = basicColors
+	}
+	log.Printf("Terminal with %d colors, color mode: %d", gc.Colors(), p.mode)
+	return p
+}
+
+// attr returns the attribute drawing in the color of the player. Colors that
+// are not hex strings or do not fit in the color pairs are drawn normally.
+func (p *palette) attr(c types.PlayerColor) gc.Char {
+	if p.mode == monochrome {
+		return gc.A_NORMAL
+	}
+	pair, ok := p.pairs[c]
+	if !ok {
+		pair = p.newPair(c)
+		p.pairs[c] = pair
+	}
+	if pair == 0 {
+		return gc.A_NORMAL
+	}
+	return gc.ColorPair(pair)
+}
+
+func (p *palette) newPair(c types.PlayerColor) int16 {
+	r, g, b, ok := parseHexColor(string(c))
+	if !ok || int(p.next_pair) >= gc.ColorPairs() {
+		return 0
+	}
+	// trails are drawn on black, too dark colors would not show
+	if r+g+b < min_brightness {
+		r, g, b = 255, 255, 255
+	}
+	if err := gc.InitPair(p.next_pair, p.nearest(r, g, b), gc.C_BLACK); err != nil {
+		log.Printf("Unable to init color pair for %s: %s", c, err.Error())
+		return 0
+	}
+	p.next_pair++
+	return p.next_pair - 1
+}
+
+// nearest returns the color of the terminal closest to the given one.
+func (p *palette) nearest(r int, g int, b int) int16 {
+	switch p.mode {
+	case trueColors:
+		if int(p.next_slot) < gc.Colors() {
+			// curses takes the components in the 0-1000 range
+			err := gc.InitColor(p.next_slot, int16(r*1000/255), int16(g*1000/255), int16(b*1000/255))
+			if err == nil {
+				p.next_slot++
+				return p.next_slot - 1
+			}
+			log.Printf("Unable to redefine color %d: %s", p.next_slot, err.Error())
+		}
+		return nearestXterm(r, g, b)
+	case xtermColors:
+		return nearestXterm(r, g, b)
+	}
+	return nearestBasic(r, g, b)
+}
+
+// parseHexColor parses colors like "#FF8000".
+func parseHexColor(s string) (r int, g int, b int, ok bool) {
+	if len(s) != 7 || s[0] != '#' {
+		return 0, 0, 0, false
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff), true
+}
+
+// nearestXterm returns the closest color of the xterm color cube or of its
+// gray ramp.
+func nearestXterm(r int, g int, b int) int16 {
+	ri, gi, bi := cubeIndex(r), cubeIndex(g), cubeIndex(b)
+	cube := int16(16 + 36*ri + 6*gi + bi)
+	cube_dist := colorDistance(r, g, b, cube_levels[ri], cube_levels[gi], cube_levels[bi])
+
+	// the gray ramp goes from 8 to 238 in steps of 10
+	gray_i := ((r+g+b)/3 - 3) / 10
+	if gray_i < 0 {
+		gray_i = 0
+	} else if gray_i > 23 {
+		gray_i = 23
+	}
+	level := 8 + 10*gray_i
+	if colorDistance(r, g, b, level, level, level) < cube_dist {
+		return int16(232 + gray_i)
+	}
+	return cube
+}
+
+func cubeIndex(v int) int {
+	best := 0
+	for i, level := range cube_levels {
+		if abs(v-level) < abs(v-cube_levels[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// nearestBasic returns the closest of the 8 basic colors.
+func nearestBasic(r int, g int, b int) int16 {
+	c := int16(0)
+	if r >= 128 {
+		c |= gc.C_RED
+	}
+	if g >= 128 {
+		c |= gc.C_GREEN
+	}
+	if b >= 128 {
+		c |= gc.C_BLUE
+	}
+	return c
+}
+
+func colorDistance(r1 int, g1 int, b1 int, r2 int, g2 int, b2 int) int {
+	return (r1-r2)*(r1-r2) + (g1-g2)*(g1-g2) + (b1-b2)*(b1-b2)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -5,6 +5,8 @@ import (
 	gc "github.com/rthornton128/goncurses"
 	"github.com/tron_client/types"
 	"log"
+	"strings"
+	"sync"
 )
 
 var player_tokens = [...]byte{
@@ -12,11 +14,37 @@ var player_tokens = [...]byte{
 	'a', 'b', 'c', 'd',
 }
 
+// teammates share the token of their team
+var team_tokens = [...]byte{'A', 'B', 'C', 'D'}
+
+// head markers are drawn over the last cell of the trails in the color of
+// the player, without colors the token of the head is reversed instead
+const head_marker = '@'
+
+// width of the legend next to the board
+const legend_width = 20
+
 type NCurseGame struct {
-	scr         *gc.Window
-	gameWin     *gc.Window
-	colors      map[types.PlayerColor]gc.Char
-	token_index int
+	scr       *gc.Window
+	gameWin   *gc.Window
+	statusWin *gc.Window
+	legendWin *gc.Window
+	board     *board
+	palette   *palette
+
+	// the board is drawn by the ticks and the input on resizes
+	lock sync.Mutex
+	// cells changed since the last drawing, everything is drawn again if
+	// redraw is set
+	dirty   map[Position]bool
+	redraw  bool
+	inFrame bool
+
+	// the viewport follows the head of a player if the terminal is too small
+	view       viewport
+	follow     types.PlayerColor
+	tooSmall   bool
+	showLegend bool
 }
 
 func NewNCurseGame(width int, height int) *NCurseGame {
@@ -25,92 +53,569 @@ func NewNCurseGame(width int, height int) *NCurseGame {
 	if err != nil {
 		log.Fatal("Init screen:", err)
 	}
-	if err := gc.StartColor(); err != nil {
-		log.Fatal(err)
-	}
-	// need 2 characters to draw borders
-	gameWin, err := gc.NewWindow(height+2, width+2, 0, 0)
+	// the windows get their size from layout
+	gameWin, err := gc.NewWindow(1, 1, 0, 0)
 	if err != nil {
 		log.Fatal("Init output window:", err)
 	}
+	// report arrow keys with their own key codes
+	gameWin.Keypad(true)
+	statusWin, err := gc.NewWindow(1, 1, 0, 0)
+	if err != nil {
+		log.Fatal("Init status window:", err)
+	}
+	legendWin, err := gc.NewWindow(1, 1, 0, 0)
+	if err != nil {
+		log.Fatal("Init legend window:", err)
+	}
 	n := &NCurseGame{
-		scr:     screen,
-		gameWin: gameWin,
+		scr:       screen,
+		gameWin:   gameWin,
+		statusWin: statusWin,
+		legendWin: legendWin,
+		board:     newBoard(width, height),
+		palette:   newPalette(),
+		dirty:     make(map[Position]bool),
 	}
-	n.reset()
-	gc.Update()
+	n.layout()
+	n.draw()
 	return n
 }
 
-func (n *NCurseGame) reset() {
-	n.gameWin.Erase()
-	n.gameWin.Box(gc.ACS_VLINE, gc.ACS_HLINE)
-	n.gameWin.NoutRefresh()
-	n.token_index = 0
+// layout fits the windows in the terminal. The board is shown through a
+// viewport if the terminal is too small for it, the legend is left out if
+// there is no room for it.
+func (n *NCurseGame) layout() {
+	rows, cols := n.scr.MaxYX()
+	b := n.board
+	// need 2 characters to draw borders and a line for the status
+	n.view.width, n.view.height = b.width, b.height
+	if cols-2 < n.view.width {
+		n.view.width = cols - 2
+	}
+	if rows-3 < n.view.height {
+		n.view.height = rows - 3
+	}
+	n.tooSmall = n.view.width < b.width || n.view.height < b.height
+	if n.view.width < 1 || n.view.height < 1 {
+		log.Printf("Terminal too small: %dx%d", cols, rows)
+		n.view.width, n.view.height = 0, 0
+		return
+	}
+	n.view.clamp(b.width, b.height)
+
+	n.gameWin.Resize(n.view.height+2, n.view.width+2)
+	n.statusWin.Resize(1, n.view.width+2)
+	n.statusWin.MoveWindow(n.view.height+2, 0)
+	n.showLegend = cols >= n.view.width+2+legend_width
+	if n.showLegend {
+		n.legendWin.Resize(n.view.height+2, legend_width)
+		n.legendWin.MoveWindow(0, n.view.width+2)
+	}
+	// clear what the old layout left on the screen
+	n.scr.Erase()
+	n.scr.NoutRefresh()
+	n.redraw = true
+}
+
+func (n *NCurseGame) BeginFrame() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.inFrame = true
+}
+
+func (n *NCurseGame) EndFrame() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.inFrame = false
+	n.draw()
 }
 
-func (n *NCurseGame) SetBlocks(blocks []PlayerBlock) error {
-	// start from scratch
-	n.reset()
-	return n.AppendBlocks(blocks)
+// changed draws the changes right away if they are not part of a frame.
+func (n *NCurseGame) changed() {
+	if !n.inFrame {
+		n.draw()
+	}
+}
+
+// scroll moves the viewport to the overlay or to the followed head.
+func (n *NCurseGame) scroll() {
+	old := n.view
+	if len(n.board.overlay) > 0 {
+		ox, oy, w, h := n.board.overlayRect()
+		n.view.center(Position{X: ox + w/2, Y: oy + h/2})
+	} else if head, ok := n.board.heads[n.follow]; ok {
+		n.view.follow(head)
+	}
+	n.view.clamp(n.board.width, n.board.height)
+	if n.view != old {
+		n.redraw = true
+	}
 }
 
-func (n *NCurseGame) AppendBlocks(blocks []PlayerBlock) error {
-	for _, b := range blocks {
-		// check if color already used
-		if val, ok := n.colors[b.Color]; ok {
-			n.gameWin.MoveAddChar(b.Pos.Y, b.Pos.X, val)
+func (n *NCurseGame) draw() {
+	b := n.board
+	if n.view.width == 0 {
+		n.dirty = make(map[Position]bool)
+		return
+	}
+	n.scroll()
+	if n.redraw {
+		n.gameWin.Erase()
+		if b.border.Wrap {
+			// dotted edges show that players come back on the other side
+			n.gameWin.Box(gc.Char(':'), gc.Char('.'))
 		} else {
-			if n.token_index >= len(player_tokens) {
-				return fmt.Errorf("Running out of player tokens")
+			n.gameWin.Box(gc.ACS_VLINE, gc.ACS_HLINE)
+		}
+		if n.tooSmall {
+			msg := fmt.Sprintf(" terminal too small for %dx%d arena ", b.width, b.height)
+			if len(msg) > n.view.width {
+				msg = msg[:n.view.width]
+			}
+			n.gameWin.Move(0, 1)
+			n.gameWin.Print(msg)
+		}
+		for y := n.view.y; y < n.view.y+n.view.height; y++ {
+			for x := n.view.x; x < n.view.x+n.view.width; x++ {
+				n.drawCell(Position{X: x, Y: y})
+			}
+		}
+	} else {
+		for pos := range n.dirty {
+			n.drawCell(pos)
+		}
+	}
+	n.redraw = false
+	n.dirty = make(map[Position]bool)
+
+	// the overlay covers the board
+	if len(b.overlay) > 0 {
+		ox, oy, w, h := b.overlayRect()
+		for y := oy; y < oy+h; y++ {
+			for x := ox; x < ox+w; x++ {
+				n.drawCell(Position{X: x, Y: y})
 			}
-			// assign new token
-			n.colors[b.Color] = gc.Char(player_tokens[n.token_index])
-			n.token_index++
-			n.gameWin.MoveAddChar(b.Pos.Y, b.Pos.X, n.colors[b.Color])
 		}
 	}
+
+	status := b.status
+	if len(status) > n.view.width+2 {
+		status = status[:n.view.width+2]
+	}
+	n.statusWin.Erase()
+	n.statusWin.Move(0, 0)
+	n.statusWin.Print(status)
+
+	if n.showLegend {
+		n.legendWin.Erase()
+		for i, line := range b.legendLines() {
+			if i >= n.view.height {
+				break
+			}
+			if len(line) > legend_width-1 {
+				line = line[:legend_width-1]
+			}
+			attr := n.palette.attr(b.legend[i].Color)
+			n.legendWin.Move(i+1, 1)
+			n.legendWin.AttrOn(attr)
+			n.legendWin.Print(line)
+			n.legendWin.AttrOff(attr)
+		}
+		n.legendWin.NoutRefresh()
+	}
+
+	n.gameWin.NoutRefresh()
+	n.statusWin.NoutRefresh()
 	gc.Update()
-	return nil
 }
 
-func (n *NCurseGame) Close() {
-	n.gameWin.Delete()
-	gc.End()
+func (n *NCurseGame) drawCell(pos Position) {
+	if !n.board.inside(pos) || !n.view.contains(pos) {
+		return
+	}
+	y, x := pos.Y-n.view.y+1, pos.X-n.view.x+1
+	if ch, ok := n.board.overlayAt(pos.X, pos.Y); ok {
+		n.gameWin.MoveAddChar(y, x, gc.Char(ch))
+		return
+	}
+	ch := gc.Char(n.board.glyph(pos.X, pos.Y, ' '))
+	color := n.board.cells[pos.Y][pos.X].Color
+	if color == "" || n.board.border.Closed(pos.X, pos.Y, n.board.width, n.board.height) {
+		n.gameWin.MoveAddChar(y, x, ch)
+		return
+	}
+	attr := n.palette.attr(color)
+	if n.board.isHead(pos) {
+		if n.palette.mode == monochrome {
+			attr |= gc.A_REVERSE
+		} else {
+			ch = head_marker
+			attr |= gc.A_BOLD
+		}
+	}
+	n.gameWin.MoveAddChar(y, x, ch|attr)
 }
 
-func (n *NCurseGame) SetWin(name string) {
-	n.reset()
+func (n *NCurseGame) Reset() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.board.reset()
+	n.redraw = true
+	n.changed()
+}
 
-	// move cursor to center
-	h, w := n.gameWin.MaxYX()
-	n.gameWin.Move(h/2, w/2-6)
+func (n *NCurseGame) SetCell(pos Position, c Cell) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	err := n.board.setCell(pos, c)
+	n.dirty[pos] = true
+	n.changed()
+	return err
+}
+
+func (n *NCurseGame) ClearCell(pos Position) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.board.clearCell(pos)
+	n.dirty[pos] = true
+	n.changed()
+}
 
+func (n *NCurseGame) SetHead(color types.PlayerColor, pos Position) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if old, ok := n.board.heads[color]; ok {
+		n.dirty[old] = true
+	}
+	n.board.heads[color] = pos
+	n.dirty[pos] = true
+	n.changed()
+}
+
+func (n *NCurseGame) ClearHead(color types.PlayerColor) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if old, ok := n.board.heads[color]; ok {
+		delete(n.board.heads, color)
+		n.dirty[old] = true
+		n.changed()
+	}
+}
+
+func (n *NCurseGame) SetBorder(b Border) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.board.border = b
+	n.redraw = true
+	n.changed()
+}
+
+func (n *NCurseGame) SetStatus(line string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.board.status = line
+	n.changed()
+}
+
+func (n *NCurseGame) SetLegend(entries []LegendEntry) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if err := n.board.setLegend(entries); err != nil {
+		log.Printf("Set legend: %s", err.Error())
+	}
+	n.changed()
+}
+
+func (n *NCurseGame) Follow(color types.PlayerColor) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.follow = color
+	n.changed()
+}
+
+func (n *NCurseGame) ShowOverlay(lines []string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	// a smaller overlay uncovers cells of the previous one
+	if len(n.board.overlay) > 0 {
+		n.redraw = true
+	}
+	n.board.overlay = append([]string(nil), lines...)
+	n.changed()
+}
+
+func (n *NCurseGame) HideOverlay() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.board.overlay = nil
+	n.redraw = true
+	n.changed()
+}
+
+func (n *NCurseGame) SetWin(name string) {
 	log.Printf("SetWin called, winner is: %s", name)
-	n.gameWin.Printf("Winner is: %s", name)
+	n.ShowOverlay(winLines(name))
 }
 
+func (n *NCurseGame) ShowScoreboard(lines []string) {
+	n.ShowOverlay(lines)
+}
+
+// UserInput returns the next key pressed. Resizing the terminal is handled
+// here, ncurses reports it as a key.
 func (n *NCurseGame) UserInput() PlayerKey {
 	for {
 		key := n.gameWin.GetChar()
-		switch key {
-		case gc.KEY_UP:
-			return Up
-		case gc.KEY_DOWN:
-			return Down
-		case gc.KEY_LEFT:
-			return Left
-		case gc.KEY_RIGHT:
-			return Right
-		case 119: // w
-			return Key_w
-		case 97: // a
-			return Key_a
-		case 115: // s
-			return Key_s
-		case 100: // d
-			return Key_d
+		if key != gc.KEY_RESIZE {
+			return PlayerKey(key)
 		}
+		n.lock.Lock()
+		n.layout()
+		n.draw()
+		n.lock.Unlock()
+	}
+}
+
+func (n *NCurseGame) Close() {
+	n.legendWin.Delete()
+	n.statusWin.Delete()
+	n.gameWin.Delete()
+	gc.End()
+}
+
+func winLines(name string) []string {
+	if name == "" {
+		return []string{"It is a draw"}
+	}
+	return []string{"Winner is: " + name}
+}
+
+// HeadlessGame keeps the board in memory instead of drawing it. User input is
+// read from the Input channel.
+type HeadlessGame struct {
+	Input chan PlayerKey
+
+	board *board
+	// snapshots of the board after the last frames and the number of frames
+	frames     []string
+	frameCount int
+	winner     *string
+	scoreboard []string
+	lock       sync.Mutex
+
+	stop      chan bool
+	closeOnce sync.Once
+}
+
+// number of frames a HeadlessGame keeps, the game may run for a long time in
+// tournaments and net bots
+const maxHeadlessFrames = 100
+
+func NewHeadlessGame(width int, height int) *HeadlessGame {
+	return &HeadlessGame{
+		Input: make(chan PlayerKey, 10),
+		board: newBoard(width, height),
+		stop:  make(chan bool),
+	}
+}
+
+func (g *HeadlessGame) BeginFrame() {}
+
+// EndFrame records a snapshot of the board. Only the last maxHeadlessFrames
+// are kept.
+func (g *HeadlessGame) EndFrame() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.frames) == maxHeadlessFrames {
+		copy(g.frames, g.frames[1:])
+		g.frames = g.frames[:len(g.frames)-1]
+	}
+	g.frames = append(g.frames, g.render())
+	g.frameCount++
+}
+
+// render draws the board the same way as NCurseGame, using one token per
+// color, the glyph of items and '.' for empty cells. Head markers and the
+// overlay are left out.
+func (g *HeadlessGame) render() string {
+	var sb strings.Builder
+	for y := 0; y < g.board.height; y++ {
+		for x := 0; x < g.board.width; x++ {
+			sb.WriteByte(g.board.glyph(x, y, '.'))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func (g *HeadlessGame) Reset() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.reset()
+	g.winner = nil
+}
+
+func (g *HeadlessGame) SetCell(pos Position, c Cell) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.board.setCell(pos, c)
+}
+
+func (g *HeadlessGame) ClearCell(pos Position) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.clearCell(pos)
+}
+
+func (g *HeadlessGame) SetHead(color types.PlayerColor, pos Position) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.heads[color] = pos
+}
+
+func (g *HeadlessGame) ClearHead(color types.PlayerColor) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.board.heads, color)
+}
+
+func (g *HeadlessGame) SetBorder(b Border) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.border = b
+}
+
+func (g *HeadlessGame) SetStatus(line string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.status = line
+}
+
+func (g *HeadlessGame) SetLegend(entries []LegendEntry) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if err := g.board.setLegend(entries); err != nil {
+		log.Printf("Set legend: %s", err.Error())
+	}
+}
+
+func (g *HeadlessGame) Follow(color types.PlayerColor) {}
+
+func (g *HeadlessGame) ShowOverlay(lines []string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.overlay = append([]string(nil), lines...)
+}
+
+func (g *HeadlessGame) HideOverlay() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.board.overlay = nil
+}
+
+func (g *HeadlessGame) SetWin(name string) {
+	g.ShowOverlay(winLines(name))
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.winner = &name
+}
+
+func (g *HeadlessGame) ShowScoreboard(lines []string) {
+	g.ShowOverlay(lines)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.scoreboard = append([]string(nil), lines...)
+}
+
+func (g *HeadlessGame) UserInput() PlayerKey {
+	select {
+	case key := <-g.Input:
+		return key
+	case <-g.stop:
+		return 0
 	}
+}
+
+func (g *HeadlessGame) Close() {
+	g.closeOnce.Do(func() { close(g.stop) })
+}
+
+// Scoreboard returns the last scoreboard shown.
+func (g *HeadlessGame) Scoreboard() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.scoreboard
+}
+
+// Cell returns the color of the player occupying the cell, or an empty color.
+func (g *HeadlessGame) Cell(x int, y int) types.PlayerColor {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.board.cells[y][x].Color
+}
+
+// Head returns the position of the head marker of the player.
+func (g *HeadlessGame) Head(color types.PlayerColor) (Position, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	pos, ok := g.board.heads[color]
+	return pos, ok
+}
+
+// Status returns the status line.
+func (g *HeadlessGame) Status() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.board.status
+}
+
+// Legend returns the lines of the legend.
+func (g *HeadlessGame) Legend() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.board.legendLines()
+}
+
+// Overlay returns the lines shown over the board.
+func (g *HeadlessGame) Overlay() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.board.overlay
+}
+
+// Winner returns the name of the winner and whether the game has ended. An
+// empty name means the game is a draw.
+func (g *HeadlessGame) Winner() (string, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.winner == nil {
+		return "", false
+	}
+	return *g.winner, true
+}
+
+// Frame returns a snapshot of the board after the last frame.
+func (g *HeadlessGame) Frame() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.frames) == 0 {
+		return ""
+	}
+	return g.frames[len(g.frames)-1]
+}
+
+// Frames returns the snapshots of the board after the last frames, oldest
+// first. At most maxHeadlessFrames are kept.
+func (g *HeadlessGame) Frames() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return append([]string(nil), g.frames...)
+}
 
+// FrameCount returns the number of frames drawn.
+func (g *HeadlessGame) FrameCount() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.frameCount
 }
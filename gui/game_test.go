@@ -0,0 +1,31 @@
+package gui
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHeadlessGameFrames(t *testing.T) {
+	assert := assert.New(t)
+	g := NewHeadlessGame(3, 1)
+	assert.Equal("", g.Frame())
+	assert.Empty(g.Frames())
+
+	// only the last frames are kept, the count goes on
+	for i := 0; i < maxHeadlessFrames+5; i++ {
+		g.SetCell(Position{X: i % 3, Y: 0}, Cell{Color: "a"})
+		g.EndFrame()
+		g.ClearCell(Position{X: i % 3, Y: 0})
+	}
+	frames := g.Frames()
+	assert.Equal(maxHeadlessFrames, len(frames))
+	assert.Equal(maxHeadlessFrames+5, g.FrameCount())
+	assert.Equal("0..\n", frames[len(frames)-3])
+	assert.Equal(".0.\n", frames[len(frames)-2])
+	assert.Equal(g.Frame(), frames[len(frames)-1])
+
+	// closing twice does not panic, input is not waited for after closing
+	g.Close()
+	g.Close()
+	assert.Equal(PlayerKey(0), g.UserInput())
+}
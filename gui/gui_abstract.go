@@ -1,42 +1,159 @@
 package gui
 
 import (
+	"fmt"
+	gc "github.com/rthornton128/goncurses"
 	"github.com/tron_client/types"
+	"time"
 )
 
 type ChatGui interface {
-	SetChatHistory(msgs []string)
+	SetChatHistory(entries []ChatEntry)
+	// ShowTimestamps tells if the time of the entries is shown
+	ShowTimestamps(show bool)
+	// Search highlights the text in the history, an empty text clears it
+	Search(text string)
+	// SetCompleter sets what completes the words of the input
+	SetCompleter(c Completer)
+	// SetPlayers updates the list of players in the lobby
+	SetPlayers(players []types.LobbyPlayer)
+	SetStatus(status LobbyStatus)
 	FetchOne() (string, error)
 	Close()
 }
 
+// LobbyStatus is shown in the status bar of the lobby.
+type LobbyStatus struct {
+	// State of the connection to the server
+	State string
+	// Server and Room are empty if not connected
+	Server string
+	Room   string
+}
+
+// ChatKind tells how a chat entry is styled.
+type ChatKind int
+
+const (
+	// ChatMessage is sent by a player, the name is drawn in the player color
+	ChatMessage ChatKind = iota
+	// SystemMessage is dimmed
+	SystemMessage
+	// ErrorMessage is highlighted
+	ErrorMessage
+)
+
+type ChatEntry struct {
+	Sender string
+	// Color is empty if the sender is not a player
+	Color types.PlayerColor
+	Time  time.Time
+	Kind  ChatKind
+	Text  string
+}
+
+func (e ChatEntry) String() string {
+	return fmt.Sprintf("%s: %s", e.Sender, e.Text)
+}
+
 type Position struct {
 	X int
 	Y int
 }
 
-type PlayerKey string
+// PlayerKey is the raw code of a key pressed by a player.
+type PlayerKey int
 
 const (
-	Up    PlayerKey = "up"
-	Down  PlayerKey = "down"
-	Left  PlayerKey = "left"
-	Right PlayerKey = "right"
-	Key_w PlayerKey = "w"
-	Key_a PlayerKey = "a"
-	Key_s PlayerKey = "s"
-	Key_d PlayerKey = "d"
+	Up    PlayerKey = PlayerKey(gc.KEY_UP)
+	Down  PlayerKey = PlayerKey(gc.KEY_DOWN)
+	Left  PlayerKey = PlayerKey(gc.KEY_LEFT)
+	Right PlayerKey = PlayerKey(gc.KEY_RIGHT)
+	Key_w PlayerKey = 'w'
+	Key_a PlayerKey = 'a'
+	Key_s PlayerKey = 's'
+	Key_d PlayerKey = 'd'
+	// action key of the arrow keys player
+	Key_enter PlayerKey = '\n'
+
+	// replay controls
+	Key_space    PlayerKey = ' '
+	Key_n        PlayerKey = 'n'
+	Key_plus     PlayerKey = '+'
+	Key_minus    PlayerKey = '-'
+	Key_lbracket PlayerKey = '['
+	Key_rbracket PlayerKey = ']'
+	Key_r        PlayerKey = 'r'
+	Key_q        PlayerKey = 'q'
 )
 
 type PlayerBlock struct {
 	Pos   Position
 	Color types.PlayerColor
+	// Team is 0 if the player plays alone, teammates are drawn alike
+	Team int
 }
 
+// Border describes the edge of the arena.
+type Border struct {
+	// Wrap is set if players leaving the arena come back on the other side
+	Wrap bool
+	// Inset is the number of cells the walls have closed in on each side
+	Inset int
+	// Obstacles are the cells of the arena taken by walls of the map
+	Obstacles map[Position]bool
+}
+
+// Closed tells if the cell is outside the walls of an arena of the given size
+// or it is an obstacle.
+func (b Border) Closed(x int, y int, width int, height int) bool {
+	return x < b.Inset || y < b.Inset || x >= width-b.Inset || y >= height-b.Inset ||
+		b.Obstacles[Position{X: x, Y: y}]
+}
+
+// Cell is the content of a cell of the board: the trail of a player or an
+// item drawn with its glyph.
+type Cell struct {
+	Color types.PlayerColor
+	// Team is 0 if the player plays alone, teammates are drawn alike
+	Team  int
+	Glyph byte
+}
+
+// LegendEntry tells the name of the player drawn in a color.
+type LegendEntry struct {
+	Color types.PlayerColor
+	Team  int
+	Name  string
+}
+
+// GameGui draws the board incrementally. Changes made between BeginFrame and
+// EndFrame are shown together, changes made outside a frame are shown right
+// away.
 type GameGui interface {
-	SetBlocks([]PlayerBlock) error
-	AppendBlocks([]PlayerBlock) error
+	BeginFrame()
+	EndFrame()
+	// Reset empties the board and hides the overlay, the border is kept
+	Reset()
+	SetCell(pos Position, c Cell) error
+	ClearCell(pos Position)
+	// SetHead moves the head marker of the player to the cell
+	SetHead(color types.PlayerColor, pos Position)
+	ClearHead(color types.PlayerColor)
+	SetBorder(b Border)
+	// SetStatus replaces the line shown under the board
+	SetStatus(line string)
+	// SetLegend lists the players next to the board, it is kept on Reset
+	SetLegend(entries []LegendEntry)
+	// Follow keeps the head of the player in view if the terminal is too
+	// small for the whole board
+	Follow(color types.PlayerColor)
+	// ShowOverlay shows the lines in a box over the board until it is hidden
+	ShowOverlay(lines []string)
+	HideOverlay()
+	SetWin(name string)
+	// ShowScoreboard shows the lines over the board
+	ShowScoreboard(lines []string)
 	UserInput() PlayerKey
 	Close()
-	SetWin(name string)
 }
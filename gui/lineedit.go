@@ -0,0 +1,288 @@
+package gui
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// the input history is kept between sessions in this file of the home
+// directory
+const history_file = ".tron_history"
+
+// the most lines of the input history kept
+const max_history = 500
+
+// Completer returns the words that may complete the prefix of a word typed
+// after the given words.
+type Completer func(words []string, prefix string) []string
+
+// lineEditor is the input line of the chat.
+type lineEditor struct {
+	line   []rune
+	cursor int
+	// first character shown if the line is wider than the window
+	offset int
+
+	history []string
+	// file the history is saved to, it is not saved if empty
+	historyFile string
+	// index of the line of the history shown, len(history) while editing a
+	// new line which is kept in draft
+	histIndex int
+	draft     []rune
+
+	completer Completer
+	// candidates of the last completion, Tab cycles through them
+	candidates []string
+	candIndex  int
+}
+
+func newLineEditor() *lineEditor {
+	e := &lineEditor{historyFile: historyPath()}
+	e.history = loadHistory(e.historyFile)
+	e.histIndex = len(e.history)
+	return e
+}
+
+func (e *lineEditor) String() string {
+	return string(e.line)
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line[:e.cursor], append([]rune{r}, e.line[e.cursor:]...)...)
+	e.cursor++
+}
+
+func (e *lineEditor) backspace() {
+	if e.cursor > 0 {
+		e.line = append(e.line[:e.cursor-1], e.line[e.cursor:]...)
+		e.cursor--
+	}
+}
+
+func (e *lineEditor) delete() {
+	if e.cursor < len(e.line) {
+		e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+	}
+}
+
+func (e *lineEditor) left() {
+	if e.cursor > 0 {
+		e.cursor--
+	}
+}
+
+func (e *lineEditor) right() {
+	if e.cursor < len(e.line) {
+		e.cursor++
+	}
+}
+
+func (e *lineEditor) home() {
+	e.cursor = 0
+}
+
+func (e *lineEditor) end() {
+	e.cursor = len(e.line)
+}
+
+// deleteWord deletes the word before the cursor and the spaces after it.
+func (e *lineEditor) deleteWord() {
+	start := e.cursor
+	for start > 0 && unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	e.line = append(e.line[:start], e.line[e.cursor:]...)
+	e.cursor = start
+}
+
+// prev shows the previous line of the history, the line being edited is kept
+// as a draft.
+func (e *lineEditor) prev() {
+	if e.histIndex == 0 {
+		return
+	}
+	if e.histIndex == len(e.history) {
+		e.draft = e.line
+	}
+	e.histIndex--
+	e.set([]rune(e.history[e.histIndex]))
+}
+
+// next shows the next line of the history, or the draft after the last one.
+func (e *lineEditor) next() {
+	if e.histIndex == len(e.history) {
+		return
+	}
+	e.histIndex++
+	if e.histIndex == len(e.history) {
+		e.set(e.draft)
+	} else {
+		e.set([]rune(e.history[e.histIndex]))
+	}
+}
+
+func (e *lineEditor) set(line []rune) {
+	e.line = append([]rune(nil), line...)
+	e.cursor = len(e.line)
+}
+
+// submit returns the line, adds it to the history unless it is empty or
+// repeated, and starts a new line.
+func (e *lineEditor) submit() string {
+	line := e.String()
+	if strings.TrimSpace(line) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+		e.history = append(e.history, line)
+		if len(e.history) > max_history {
+			// the file is trimmed along with the history
+			e.history = e.history[len(e.history)-max_history:]
+			saveHistory(e.historyFile, e.history, false)
+		} else {
+			saveHistory(e.historyFile, []string{line}, true)
+		}
+	}
+	e.histIndex = len(e.history)
+	e.line, e.draft, e.cursor, e.offset = nil, nil, 0, 0
+	return line
+}
+
+// complete completes the word before the cursor to the longest prefix shared
+// by the candidates. If there is nothing more to complete, repeated calls
+// cycle through the candidates.
+func (e *lineEditor) complete() {
+	if e.completer == nil {
+		return
+	}
+	start := e.cursor
+	for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	word := string(e.line[start:e.cursor])
+	if len(e.candidates) > 0 {
+		e.candIndex = (e.candIndex + 1) % len(e.candidates)
+		e.replaceWord(start, e.candidates[e.candIndex])
+		return
+	}
+	candidates := e.completer(strings.Fields(string(e.line[:start])), word)
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		e.replaceWord(start, candidates[0]+" ")
+		return
+	}
+	if common := commonPrefix(candidates); len([]rune(common)) > len([]rune(word)) {
+		e.replaceWord(start, common)
+		return
+	}
+	e.candidates, e.candIndex = candidates, 0
+	e.replaceWord(start, candidates[0])
+}
+
+// resetCompletion ends cycling through the candidates of the last completion.
+func (e *lineEditor) resetCompletion() {
+	e.candidates = nil
+}
+
+func (e *lineEditor) replaceWord(start int, word string) {
+	rest := e.line[e.cursor:]
+	e.line = append(append(append([]rune(nil), e.line[:start]...), []rune(word)...), rest...)
+	e.cursor = start + len([]rune(word))
+}
+
+// visible returns the part of the line fitting in the width and the position
+// of the cursor in it.
+func (e *lineEditor) visible(width int) (string, int) {
+	if width < 1 {
+		return "", 0
+	}
+	if e.cursor < e.offset {
+		e.offset = e.cursor
+	} else if e.cursor >= e.offset+width {
+		e.offset = e.cursor - width + 1
+	}
+	end := e.offset + width
+	if end > len(e.line) {
+		end = len(e.line)
+	}
+	return string(e.line[e.offset:end]), e.cursor - e.offset
+}
+
+// commonPrefix returns the longest prefix of the words, candidates differing
+// only in case share no prefix from the first difference.
+func commonPrefix(words []string) string {
+	prefix := []rune(words[0])
+	for _, w := range words[1:] {
+		runes := []rune(w)
+		n := 0
+		for n < len(prefix) && n < len(runes) && prefix[n] == runes[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+// historyPath returns the path of the history file, or an empty path if the
+// home directory is unknown.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Printf("Input history is not saved: %s", err.Error())
+		return ""
+	}
+	return filepath.Join(home, history_file)
+}
+
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Unable to read input history: %s", err.Error())
+		}
+		return nil
+	}
+	defer f.Close()
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			history = append(history, scanner.Text())
+		}
+	}
+	if len(history) > max_history {
+		history = history[len(history)-max_history:]
+	}
+	return history
+}
+
+// saveHistory appends the lines to the history file, or replaces its content
+// with them.
+func saveHistory(path string, lines []string, appending bool) {
+	if path == "" {
+		return
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appending {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		log.Printf("Unable to save input history: %s", err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err = f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		log.Printf("Unable to save input history: %s", err.Error())
+	}
+}
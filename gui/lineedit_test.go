@@ -0,0 +1,151 @@
+package gui
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func typeLine(e *lineEditor, s string) {
+	for _, r := range s {
+		e.insert(r)
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), history_file)
+	e := &lineEditor{historyFile: path}
+	for _, line := range []string{"first", "", "second", "second", "   "} {
+		typeLine(e, line)
+		assert.Equal(line, e.submit())
+	}
+	// empty and repeated lines are left out
+	assert.Equal([]string{"first", "second"}, e.history)
+	assert.Equal(e.history, loadHistory(path))
+
+	// the line being edited is kept as a draft
+	typeLine(e, "dra")
+	e.prev()
+	assert.Equal("second", e.String())
+	e.prev()
+	e.prev()
+	assert.Equal("first", e.String())
+	e.next()
+	e.next()
+	assert.Equal("dra", e.String())
+	assert.Equal(3, e.cursor)
+	e.next()
+	assert.Equal("dra", e.String())
+}
+
+func TestLineEditorHistoryLimit(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), history_file)
+	e := &lineEditor{historyFile: path}
+	for i := 0; i < max_history+10; i++ {
+		typeLine(e, fmt.Sprintf("line %d", i))
+		e.submit()
+	}
+	assert.Equal(max_history, len(e.history))
+	assert.Equal("line 10", e.history[0])
+	bytes, err := os.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal(max_history, strings.Count(string(bytes), "\n"))
+	assert.Equal(e.history, loadHistory(path))
+}
+
+func TestLineEditorDeleteWord(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		line   string
+		cursor int
+		result string
+	}{
+		{"", 0, ""},
+		{"hello", 5, ""},
+		{"hello world", 11, "hello "},
+		{"hello world  ", 13, "hello "},
+		{"hello world", 5, " world"},
+		{"hello world", 0, "hello world"},
+		{"szép napot", 10, "szép "},
+	}
+	for _, test := range tests {
+		e := &lineEditor{}
+		e.set([]rune(test.line))
+		e.cursor = test.cursor
+		e.deleteWord()
+		assert.Equal(test.result, e.String(), test.line)
+	}
+}
+
+func TestLineEditorComplete(t *testing.T) {
+	assert := assert.New(t)
+	names := []string{"Zold", "Zoltán", "Zizi"}
+	e := &lineEditor{completer: func(words []string, prefix string) []string {
+		var found []string
+		for _, n := range names {
+			if strings.HasPrefix(strings.ToLower(n), strings.ToLower(prefix)) {
+				found = append(found, n)
+			}
+		}
+		return found
+	}}
+
+	// the common prefix is completed in the casing of the candidates
+	typeLine(e, "hi zo")
+	e.complete()
+	assert.Equal("hi Zol", e.String())
+	// then the candidates are cycled
+	e.complete()
+	assert.Equal("hi Zold", e.String())
+	e.complete()
+	assert.Equal("hi Zoltán", e.String())
+	e.complete()
+	assert.Equal("hi Zold", e.String())
+
+	// a single candidate is completed with a space
+	e.resetCompletion()
+	e.set([]rune("zi"))
+	e.complete()
+	assert.Equal("Zizi ", e.String())
+
+	// multibyte characters are not split
+	assert.Equal("Zolt", commonPrefix([]string{"Zoltán", "Zoltan"}))
+	assert.Equal("á", commonPrefix([]string{"ár", "ág"}))
+	assert.Equal("", commonPrefix([]string{"Kek", "kek"}))
+}
+
+func TestLineEditorVisible(t *testing.T) {
+	assert := assert.New(t)
+	e := &lineEditor{}
+	typeLine(e, "0123456789")
+	line, cursor := e.visible(5)
+	assert.Equal("6789", line)
+	assert.Equal(4, cursor)
+	// moving left scrolls back only at the left edge
+	for i := 0; i < 4; i++ {
+		e.left()
+	}
+	line, cursor = e.visible(5)
+	assert.Equal("6789", line)
+	assert.Equal(0, cursor)
+	e.left()
+	line, cursor = e.visible(5)
+	assert.Equal("56789", line)
+	assert.Equal(0, cursor)
+	e.home()
+	line, cursor = e.visible(5)
+	assert.Equal("01234", line)
+	assert.Equal(0, cursor)
+	e.end()
+	line, cursor = e.visible(5)
+	assert.Equal("6789", line)
+	assert.Equal(4, cursor)
+	line, cursor = e.visible(0)
+	assert.Equal("", line)
+	assert.Equal(0, cursor)
+}
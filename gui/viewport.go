@@ -0,0 +1,54 @@
+package gui
+
+// viewport is the part of the board shown if the terminal is too small for
+// the whole board.
+type viewport struct {
+	// top left cell of the board shown
+	x int
+	y int
+	// number of cells shown, 0 if the terminal cannot show anything
+	width  int
+	height int
+}
+
+func (v viewport) contains(pos Position) bool {
+	return pos.X >= v.x && pos.X < v.x+v.width && pos.Y >= v.y && pos.Y < v.y+v.height
+}
+
+// follow scrolls the viewport if the cell gets closer to its edges than a
+// quarter of its size.
+func (v *viewport) follow(pos Position) {
+	mx, my := v.width/4, v.height/4
+	if pos.X < v.x+mx {
+		v.x = pos.X - mx
+	} else if pos.X >= v.x+v.width-mx {
+		v.x = pos.X - v.width + mx + 1
+	}
+	if pos.Y < v.y+my {
+		v.y = pos.Y - my
+	} else if pos.Y >= v.y+v.height-my {
+		v.y = pos.Y - v.height + my + 1
+	}
+}
+
+// center scrolls the viewport to show the cell in its middle.
+func (v *viewport) center(pos Position) {
+	v.x = pos.X - v.width/2
+	v.y = pos.Y - v.height/2
+}
+
+// clamp keeps the viewport on the board.
+func (v *viewport) clamp(width int, height int) {
+	if v.x > width-v.width {
+		v.x = width - v.width
+	}
+	if v.x < 0 {
+		v.x = 0
+	}
+	if v.y > height-v.height {
+		v.y = height - v.height
+	}
+	if v.y < 0 {
+		v.y = 0
+	}
+}
@@ -0,0 +1,51 @@
+package gui
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestViewport(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		name string
+		// size of the board and of the window in cells
+		board  Position
+		window Position
+		// viewport before scrolling, the cell scrolled to and the viewport after
+		start  Position
+		pos    Position
+		center bool
+		end    Position
+	}{
+		{"smaller follow", Position{X: 8, Y: 6}, Position{X: 20, Y: 10}, Position{}, Position{X: 7, Y: 5}, false, Position{}},
+		{"smaller center", Position{X: 8, Y: 6}, Position{X: 20, Y: 10}, Position{}, Position{X: 0, Y: 0}, true, Position{}},
+		{"equal follow", Position{X: 10, Y: 10}, Position{X: 10, Y: 10}, Position{}, Position{X: 9, Y: 9}, false, Position{}},
+		{"equal center", Position{X: 10, Y: 10}, Position{X: 10, Y: 10}, Position{}, Position{X: 9, Y: 9}, true, Position{}},
+		{"larger inside margins", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{}, Position{X: 5, Y: 3}, false, Position{}},
+		{"larger near bottom right", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{}, Position{X: 8, Y: 6}, false, Position{X: 1, Y: 1}},
+		{"larger near top left", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{X: 10, Y: 10}, Position{X: 11, Y: 11}, false, Position{X: 9, Y: 9}},
+		{"larger board corner", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{}, Position{X: 39, Y: 19}, false, Position{X: 30, Y: 12}},
+		{"larger board origin", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{X: 20, Y: 10}, Position{}, false, Position{}},
+		{"larger center", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{}, Position{X: 20, Y: 10}, true, Position{X: 15, Y: 6}},
+		{"larger center at edge", Position{X: 40, Y: 20}, Position{X: 10, Y: 8}, Position{}, Position{X: 38, Y: 1}, true, Position{X: 30, Y: 0}},
+	}
+	for _, test := range tests {
+		// the viewport is not larger than the board, see NCurseGame.layout
+		v := viewport{x: test.start.X, y: test.start.Y, width: test.window.X, height: test.window.Y}
+		if test.board.X < v.width {
+			v.width = test.board.X
+		}
+		if test.board.Y < v.height {
+			v.height = test.board.Y
+		}
+		if test.center {
+			v.center(test.pos)
+		} else {
+			v.follow(test.pos)
+		}
+		v.clamp(test.board.X, test.board.Y)
+		assert.Equal(test.end, Position{X: v.x, Y: v.y}, test.name)
+		assert.True(v.contains(test.pos), test.name)
+	}
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/tron_client/engine"
 	"github.com/tron_client/types"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 func main() {
+	replayPath := flag.String("replay", "", "play back a recorded game from file")
+	local := flag.Bool("local", false, "start with the setup of a local game")
+	flag.Parse()
+
 	f, err := os.OpenFile("tron.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatalf("error opening file: %v", err)
@@ -15,7 +24,118 @@ func main() {
 	defer f.Close()
 	log.SetOutput(f)
 
+	switch flag.Arg(0) {
+	case "tournament":
+		runTournament(flag.Args()[1:])
+		return
+	case "bot":
+		runBots(flag.Args()[1:])
+		return
+	}
+
+	if *replayPath != "" {
+		r, err := engine.LoadReplay(*replayPath)
+		if err != nil {
+			log.Fatalf("error loading replay: %v", err)
+		}
+		game := engine.NewReplayGame(r, types.NCursesGame)
+		game.Wait()
+		game.Close()
+		return
+	}
+
 	lobby := engine.NewLobbyEngine(types.NCursesLobby)
+	if *local {
+		lobby.StartLocal()
+	}
 	lobby.ListenUserInput()
 	lobby.Close()
 }
+
+// runTournament plays bots against each other and prints the results.
+func runTournament(args []string) {
+	fs := flag.NewFlagSet("tournament", flag.ExitOnError)
+	bots := fs.String("bots", strings.Join(engine.BotStrategies, ","),
+		"comma separated list of bot strategies")
+	format := fs.String("format", engine.RoundRobin, "tournament format: roundrobin or swiss")
+	rounds := fs.Int("rounds", 3, "number of rounds of a swiss tournament")
+	games := fs.Int("games", 2, "number of games per pairing")
+	width := fs.Int("width", 40, "arena width")
+	height := fs.Int("height", 20, "arena height")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed of start positions and bots")
+	replays := fs.String("replays", "", "directory to save replays of notable games into")
+	fs.Parse(args)
+
+	result, err := engine.RunTournament(engine.TournamentSettings{
+		Bots:            strings.Split(*bots, ","),
+		Format:          *format,
+		Rounds:          *rounds,
+		GamesPerPairing: *games,
+		Width:           *width,
+		Height:          *height,
+		Seed:            *seed,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tournament failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Seed: %d\n\nStandings:\n", *seed)
+	for _, line := range result.Standings() {
+		fmt.Println(line)
+	}
+	fmt.Println("\nWins (row against column):")
+	for _, line := range result.WinMatrix() {
+		fmt.Println(line)
+	}
+	if *replays != "" {
+		files, err := result.SaveReplays(*replays)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "saving replays failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("\nReplays of notable games:")
+		for _, f := range files {
+			fmt.Println(f)
+		}
+	}
+}
+
+// runBots joins a server with bot players until their connections are lost.
+func runBots(args []string) {
+	fs := flag.NewFlagSet("bot", flag.ExitOnError)
+	address := fs.String("address", "localhost", "server address")
+	port := fs.Int("port", 8765, "server port")
+	room := fs.String("room", "", "room to join, a new one if empty")
+	name := fs.String("name", "Bot", "name of the bot, numbered if there are more")
+	strategy := fs.String("strategy", "floodfill", "bot strategy: "+
+		strings.Join(engine.BotStrategies, ", ")+", exec:PROGRAM or exec-delta:PROGRAM")
+	difficulty := fs.String("difficulty", "hard", "bot difficulty: easy, normal or hard")
+	count := fs.Int("count", 1, "number of bots to join with")
+	fs.Parse(args)
+
+	d, err := engine.ParseDifficulty(*difficulty)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < *count; i++ {
+		bot, err := engine.NewBot(*strategy, d, time.Now().UnixNano()+int64(i))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		botName := *name
+		if *count > 1 {
+			botName = fmt.Sprintf("%s%d", *name, i+1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := engine.RunNetBot(*address, *port, *room, botName, bot, nil)
+			fmt.Fprintf(os.Stderr, "%s: %v\n", botName, err)
+		}()
+	}
+	wg.Wait()
+}
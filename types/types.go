@@ -7,6 +7,12 @@ type LobbyPlayer struct {
 	Color PlayerColor `json:"color"`
 	Name  string      `json:"name"`
 	Ready bool        `json:"ready"`
+	// Team is 0 if the player plays alone
+	Team int `json:"team,omitempty"`
+	// Role in the room, e.g. host or spectator, and the round trip time to
+	// the server in milliseconds, if the server tells them
+	Role string `json:"role,omitempty"`
+	Ping int    `json:"ping,omitempty"`
 }
 
 type JsonMsgI interface {
@@ -30,6 +36,9 @@ type ConnRespMsg struct {
 	Color   PlayerColor   `json:"color"`
 	Players []LobbyPlayer `json:"players"`
 	Id      string        `json:"id"`
+	// Seats is the number of players the room takes, 0 if the server does
+	// not tell
+	Seats int `json:"seats,omitempty"`
 }
 
 type ReadyMsg struct {
@@ -38,6 +47,14 @@ type ReadyMsg struct {
 	Color PlayerColor `json:"color,omitempty"`
 }
 
+// TeamMsg asks the server to put the player in a team, the server tells the
+// change to everyone with the color of the player.
+type TeamMsg struct {
+	*JsonMsg
+	Team  int         `json:"team"`
+	Color PlayerColor `json:"color,omitempty"`
+}
+
 type ChatMsg struct {
 	*JsonMsg
 	Message string      `json:"message"`
@@ -50,23 +67,84 @@ type ConnAckMsg struct {
 	Action string      `json:"action"`
 }
 
+// StartGameMsg tells the arena and the starting positions of the players.
+type StartGameMsg struct {
+	*JsonMsg
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Walls is one of "solid", "wrap" or "shrink"
+	Walls       string `json:"walls,omitempty"`
+	ShrinkEvery int    `json:"shrink_every,omitempty"`
+	// Map is set if the arena has obstacles
+	Map *Map `json:"map,omitempty"`
+	// PowerUps are spawned from a random generator seeded with Seed
+	PowerUps bool  `json:"powerups,omitempty"`
+	Seed     int64 `json:"seed,omitempty"`
+	// TeamPassable lets players pass through the trails of their teammates
+	TeamPassable bool `json:"team_passable,omitempty"`
+	// SuddenDeath is the tick the walls start closing in at, 0 if never
+	SuddenDeath int `json:"sudden_death,omitempty"`
+	// trails are not longer than TrailLength cells and fade after TrailFade
+	// ticks, 0 means no limit
+	TrailLength int             `json:"trail_length,omitempty"`
+	TrailFade   int             `json:"trail_fade,omitempty"`
+	Players     []StartPosition `json:"players"`
+}
+
+type StartPosition struct {
+	Color PlayerColor `json:"color"`
+	Name  string      `json:"name"`
+	Team  int         `json:"team,omitempty"`
+	Pos   Cell        `json:"position"`
+	Dir   Direction   `json:"direction"`
+}
+
+// Map is an arena with static obstacles and the spawn points of the players.
+type Map struct {
+	Name      string  `json:"name"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Obstacles []Cell  `json:"obstacles"`
+	Spawns    []Spawn `json:"spawns"`
+}
+
+type Spawn struct {
+	Pos Cell      `json:"position"`
+	Dir Direction `json:"direction"`
+}
+
 type TickMsg struct {
 	*JsonMsg
 	Countdown int          `json:"countdown"`
 	Changes   []GameChange `json:"changes"`
 	LastTick  bool         `json:"lasttick"`
+	// Items are the power-ups on the board after the tick
+	Items []Item `json:"items,omitempty"`
 }
 
 type GameChange struct {
 	Color PlayerColor `json:"color"`
 	Dir   Direction   `json:"direction"`
 	Dead  bool        `json:"dead"`
+	// PowerUp is the power-up in effect for the player after the tick
+	PowerUp string `json:"powerup,omitempty"`
+	// Boost is set if the player boosted in the tick
+	Boost bool `json:"boost,omitempty"`
+}
+
+// Item is a power-up waiting on the board to be picked up. Kind is one of
+// "speed", "jump" or "ghost".
+type Item struct {
+	Pos  Cell   `json:"position"`
+	Kind string `json:"kind"`
 }
 
 type PlayerEventMsg struct {
 	*JsonMsg
 	Color PlayerColor `json:"color"`
 	Dir   Direction   `json:"direction"`
+	// Action is "boost" if the player asks for a speed burst
+	Action string `json:"action,omitempty"`
 }
 
 type Direction string
@@ -91,8 +169,55 @@ const (
 	Down  = "down"
 	Left  = "left"
 	Right = "right"
+	// Forfeit kills the player, it is used for disqualified bots
+	Forfeit = "forfeit"
 )
 
+// Messages of the external bot protocol. Each message is a single line of
+// JSON on the standard input and output of the bot program.
+
+type Cell struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type BotPlayer struct {
+	Color PlayerColor `json:"color"`
+	Dir   Direction   `json:"direction"`
+	Dead  bool        `json:"dead"`
+	// PowerUp is the power-up in effect for the player
+	PowerUp string `json:"powerup,omitempty"`
+	// Trail holds every cell of the player, or only the cells added since the
+	// last tick if the bot asked for deltas
+	Trail []Cell `json:"trail"`
+	// Faded is the number of cells dropped from the tail of the trail since
+	// the last tick, it is only sent with deltas
+	Faded int `json:"faded,omitempty"`
+}
+
+type BotStartMsg struct {
+	*JsonMsg             // "start"
+	Width    int         `json:"width"`
+	Height   int         `json:"height"`
+	Color    PlayerColor `json:"color"`
+	BudgetMs int         `json:"budget_ms"`
+	Delta    bool        `json:"delta"`
+	// Obstacles are the cells taken by the walls of the map
+	Obstacles []Cell `json:"obstacles,omitempty"`
+}
+
+type BotTickMsg struct {
+	*JsonMsg             // "tick"
+	Tick     int         `json:"tick"`
+	Players  []BotPlayer `json:"players"`
+	Items    []Item      `json:"items,omitempty"`
+}
+
+type BotMoveMsg struct {
+	*JsonMsg           // "move"
+	Dir      Direction `json:"direction"`
+}
+
 func (m *JsonMsg) GetType() string {
 	return m.Type
 }